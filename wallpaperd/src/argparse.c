@@ -212,6 +212,11 @@ const char* wd_get_wallpaper_path(wd_args_state* args) {
     return args->wallpaper_path;
 }
 
+void wd_set_wallpaper_path(wd_args_state* args, const char* path) {
+    sdsfree(args->wallpaper_path);
+    args->wallpaper_path = sdsnew(path);
+}
+
 const char* wd_get_scene_option(wd_args_state* args, const char* name) {
     for(int i = 0; i < args->num_scene_options; i++) {
         if(strcmp(args->scene_options_keys[i], name) == 0) {
@@ -43,6 +43,7 @@ bool wd_parse_args(wd_args_state* args, int argc, char* argv[]);
 void wd_free_args(wd_args_state* args);
 
 const char* wd_get_wallpaper_path(wd_args_state* args);
+void wd_set_wallpaper_path(wd_args_state* args, const char* path);
 const char* wd_get_scene_option(wd_args_state* args, const char* name);
 
 #endif
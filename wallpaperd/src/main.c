@@ -3,6 +3,7 @@
 #include "argparse.h"
 #include "error.h"
 #include "output.h"
+#include "package.h"
 #include "ready.h"
 #include "scene.h"
 #include "state.h"
@@ -80,6 +81,17 @@ int main(int argc, char* argv[]) {
     }
 
     bool scene_wallpaper = is_scene(wd_get_wallpaper_path(&state.args));
+    if(scene_wallpaper) {
+        sds video_path = NULL;
+        if(!wd_get_package_video(wd_get_wallpaper_path(&state.args), &video_path)) {
+            goto handle_error;
+        }
+        if(video_path != NULL) {
+            wd_set_wallpaper_path(&state.args, video_path);
+            sdsfree(video_path);
+            scene_wallpaper = false;
+        }
+    }
     bool opengl = !scene_wallpaper;
 
 #ifndef WD_VIDEO
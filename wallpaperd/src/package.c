@@ -0,0 +1,168 @@
+#include "package.h"
+#include <SDL3/SDL.h>
+#include <stdint.h>
+#include <string.h>
+#include "cache.h"
+#include "error.h"
+#include "malloc.h"
+#include "zip.h"
+
+static const char* skip_blanks(const char* text) {
+    while(*text == ' ' || *text == '\t') {
+        text++;
+    }
+    return text;
+}
+
+// Parses the file value of a basic or literal TOML string, as wpe-compile writes it. Escape sequences and multi-line
+// strings are not supported and set an error instead of giving a wrong file name.
+static sds parse_video_file_value(const char* value) {
+    char quote = *value;
+    if(quote != '"' && quote != '\'') {
+        wd_set_error("metadata.toml: [video] file is not a string");
+        return NULL;
+    }
+    if(value[1] == quote && value[2] == quote) {
+        wd_set_error("metadata.toml: multi-line strings are not supported in [video] file");
+        return NULL;
+    }
+
+    const char* value_end = strchr(value + 1, quote);
+    if(value_end == NULL) {
+        wd_set_error("metadata.toml: [video] file is not terminated");
+        return NULL;
+    }
+    if(quote == '"' && memchr(value + 1, '\\', value_end - value - 1) != NULL) {
+        wd_set_error("metadata.toml: escape sequences are not supported in [video] file");
+        return NULL;
+    }
+
+    const char* rest = skip_blanks(value_end + 1);
+    if(*rest != '\0' && *rest != '#') {
+        wd_set_error("metadata.toml: unexpected text after [video] file");
+        return NULL;
+    }
+    return sdsnewlen(value + 1, value_end - value - 1);
+}
+
+// Finds file in the [video] section of metadata.toml. This is not a TOML parser, it only reads the single-line
+// key = "value" form that wpe-compile writes, and sets an error for values it cannot read.
+static sds parse_video_file(const char* metadata) {
+    bool video_section = false;
+    const char* line = metadata;
+    while(*line != '\0') {
+        const char* line_end = strchr(line, '\n');
+        if(line_end == NULL) {
+            line_end = line + strlen(line);
+        }
+
+        sds text = sdstrim(sdsnewlen(line, line_end - line), " \t\r");
+        if(text[0] == '[') {
+            video_section = strcmp(text, "[video]") == 0;
+        } else if(video_section && strncmp(text, "file", 4) == 0) {
+            const char* value = skip_blanks(text + 4);
+            if(*value == '=') {
+                sds file = parse_video_file_value(skip_blanks(value + 1));
+                sdsfree(text);
+                return file;
+            }
+        }
+        sdsfree(text);
+
+        line = *line_end == '\0' ? line_end : line_end + 1;
+    }
+    return NULL;
+}
+
+static sds read_video_file_name(wd_zip_state* zip) {
+    if(!wd_zip_has_file(zip, "metadata.toml")) {
+        return NULL;
+    }
+
+    size_t size = 0;
+    if(!wd_zip_get_file_size(zip, "metadata.toml", &size)) {
+        return NULL;
+    }
+    char* metadata = wd_malloc(size + 1);
+    if(!wd_zip_read_file(zip, "metadata.toml", (uint8_t*)metadata)) {
+        free(metadata);
+        return NULL;
+    }
+    metadata[size] = '\0';
+
+    sds file = parse_video_file(metadata);
+    free(metadata);
+    return file;
+}
+
+static bool extract_video(wd_zip_state* zip, const char* package_path, const char* file, sds* video_path) {
+    size_t size = 0;
+    uint32_t crc = 0;
+    if(!wd_zip_get_file_size(zip, file, &size) || !wd_zip_get_file_crc(zip, file, &crc)) {
+        return false;
+    }
+
+    sds dir = wd_cache_get_namespace_dir("video");
+    if(dir == NULL) {
+        wd_set_error("failed to create video cache directory");
+        return false;
+    }
+
+    const char* package_name = strrchr(package_path, '/');
+    package_name = package_name == NULL ? package_path : package_name + 1;
+    const char* extension = strrchr(file, '.');
+    sds path = sdscatprintf(dir, "/%s-%08x%s", package_name, crc, extension == NULL ? "" : extension);
+
+    SDL_PathInfo info;
+    if(SDL_GetPathInfo(path, &info) && info.type == SDL_PATHTYPE_FILE && info.size == size) {
+        *video_path = path;
+        return true;
+    }
+
+    // The video is written under a temporary name first, so that an interrupted extraction is not taken for a
+    // cached video.
+    sds tmp_path = sdscat(sdsdup(path), ".tmp");
+    wd_cache_remove_file(tmp_path);
+    bool extracted = wd_zip_extract_file(zip, file, tmp_path);
+    if(extracted && !SDL_RenamePath(tmp_path, path)) {
+        wd_set_error("failed to move %s to %s: %s", tmp_path, path, SDL_GetError());
+        extracted = false;
+    }
+    if(!extracted) {
+        wd_cache_remove_file(tmp_path);
+        sdsfree(tmp_path);
+        sdsfree(path);
+        return false;
+    }
+    sdsfree(tmp_path);
+
+    *video_path = path;
+    return true;
+}
+
+bool wd_get_package_video(const char* path, sds* video_path) {
+    *video_path = NULL;
+
+    wd_zip_state zip = {0};
+    if(!wd_init_zip(&zip, path)) {
+        return false;
+    }
+    if(wd_zip_has_file(&zip, "scene.wasm")) {
+        wd_free_zip(&zip);
+        return true;
+    }
+
+    sds file = read_video_file_name(&zip);
+    if(file == NULL) {
+        wd_free_zip(&zip);
+        if(!wd_is_error_set()) {
+            wd_set_error("%s has neither scene.wasm nor video", path);
+        }
+        return false;
+    }
+
+    bool success = extract_video(&zip, path, file, video_path);
+    sdsfree(file);
+    wd_free_zip(&zip);
+    return success;
+}
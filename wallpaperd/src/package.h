@@ -0,0 +1,11 @@
+#ifndef WD_PACKAGE_H
+#define WD_PACKAGE_H
+
+#include <sds.h>
+#include <stdbool.h>
+
+// If the package at path is a video package, extracts the video to cache and sets *video_path to it, otherwise sets
+// *video_path to NULL. Returns false on error.
+bool wd_get_package_video(const char* path, sds* video_path);
+
+#endif
@@ -1,7 +1,11 @@
 #include "zip.h"
+#include <SDL3/SDL.h>
 #include <string.h>
 #include <zip.h>
 #include "error.h"
+#include "malloc.h"
+
+#define WD_ZIP_EXTRACT_CHUNK_SIZE (1024 * 1024)
 
 bool wd_init_zip(wd_zip_state* zip, const char* path) {
     int error = 0;
@@ -17,6 +21,10 @@ bool wd_init_zip(wd_zip_state* zip, const char* path) {
     return true;
 }
 
+bool wd_zip_has_file(wd_zip_state* zip, const char* path) {
+    return zip_name_locate(zip->archive, path, 0) >= 0;
+}
+
 bool wd_zip_get_file_size(wd_zip_state* zip, const char* path, size_t* size) {
     zip_stat_t stat = {0};
     memset(&stat, 0, sizeof(stat));
@@ -40,6 +48,23 @@ bool wd_zip_get_file_size(wd_zip_state* zip, const char* path, size_t* size) {
     return true;
 }
 
+bool wd_zip_get_file_crc(wd_zip_state* zip, const char* path, uint32_t* crc) {
+    zip_stat_t stat = {0};
+    memset(&stat, 0, sizeof(stat));
+    if(zip_stat(zip->archive, path, 0, &stat) != 0) {
+        wd_set_error("zip_stat for %s failed: %s", path, zip_strerror(zip->archive));
+        return false;
+    }
+
+    if((stat.valid & ZIP_STAT_CRC) == 0) {
+        wd_set_error("CRC of %s is unknown", path);
+        return false;
+    }
+
+    *crc = stat.crc;
+    return true;
+}
+
 bool wd_zip_read_file(wd_zip_state* zip, const char* path, uint8_t* result) {
     size_t size = 0;
     if(!wd_zip_get_file_size(zip, path, &size)) {
@@ -81,6 +106,60 @@ bool wd_zip_read_file(wd_zip_state* zip, const char* path, uint8_t* result) {
     return true;
 }
 
+bool wd_zip_extract_file(wd_zip_state* zip, const char* path, const char* output_path) {
+    size_t size = 0;
+    if(!wd_zip_get_file_size(zip, path, &size)) {
+        return false;
+    }
+
+    zip_file_t* file = zip_fopen(zip->archive, path, 0);
+    if(file == NULL) {
+        wd_set_error("zip_fopen for %s failed: %s", path, zip_strerror(zip->archive));
+        return false;
+    }
+    SDL_IOStream* output = SDL_IOFromFile(output_path, "wb");
+    if(output == NULL) {
+        wd_set_error("failed to open %s: %s", output_path, SDL_GetError());
+        zip_fclose(file);
+        return false;
+    }
+
+    uint8_t* chunk = wd_malloc(WD_ZIP_EXTRACT_CHUNK_SIZE);
+    size_t offset = 0;
+    bool success = true;
+    while(offset < size) {
+        zip_int64_t read = zip_fread(file, chunk, WD_ZIP_EXTRACT_CHUNK_SIZE);
+        if(read < 0) {
+            zip_error_t* file_error = zip_file_get_error(file);
+            wd_set_error("zip_fread for %s failed: %s", path, zip_error_strerror(file_error));
+            success = false;
+            break;
+        }
+        if(read == 0) {
+            break;
+        }
+        if(SDL_WriteIO(output, chunk, (size_t)read) != (size_t)read) {
+            wd_set_error("failed to write %s: %s", output_path, SDL_GetError());
+            success = false;
+            break;
+        }
+        offset += read;
+    }
+
+    if(success && offset != size) {
+        wd_set_error(
+            "zip_fread for %s failed: unexpected EOF (read %zu bytes, expected %zu bytes)", path, offset, size);
+        success = false;
+    }
+    if(!SDL_CloseIO(output) && success) {
+        wd_set_error("failed to write %s: %s", output_path, SDL_GetError());
+        success = false;
+    }
+    free(chunk);
+    zip_fclose(file);
+    return success;
+}
+
 void wd_free_zip(wd_zip_state* zip) {
     if(zip->archive != NULL) {
         zip_close(zip->archive);
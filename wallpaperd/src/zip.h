@@ -10,8 +10,12 @@ typedef struct wd_zip_state {
 } wd_zip_state;
 
 bool wd_init_zip(wd_zip_state* zip, const char* path);
+bool wd_zip_has_file(wd_zip_state* zip, const char* path);
 bool wd_zip_get_file_size(wd_zip_state* zip, const char* path, size_t* size);
+bool wd_zip_get_file_crc(wd_zip_state* zip, const char* path, uint32_t* crc);
 bool wd_zip_read_file(wd_zip_state* zip, const char* path, uint8_t* result);
+// Writes the file at path to output_path in chunks, without holding the whole file in memory.
+bool wd_zip_extract_file(wd_zip_state* zip, const char* path, const char* output_path);
 void wd_free_zip(wd_zip_state* zip);
 
 #endif
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexflint/go-arg"
+
+	"github.com/mechakotik/openwallpaper/wpe-compile/compiler"
+)
+
+type batchArgs struct {
+	Input       string        `arg:"positional,required"`
+	Output      string        `arg:"positional,required"`
+	Assets      []string      `arg:"--assets,separate"`
+	Particles   bool          `arg:"--particles" default:"true"`
+	Module      string        `arg:"--module"`
+	Overwrite   bool          `arg:"--overwrite"`
+	TaskTimeout time.Duration `arg:"--task-timeout"`
+	Jobs        int           `arg:"--jobs"`
+	CacheDir    string        `arg:"--cache-dir"`
+	NoCache     bool          `arg:"--no-cache"`
+	Progress    string        `arg:"--progress" default:"auto"`
+	Debug       bool          `arg:"--debug"`
+}
+
+type batchStatus string
+
+const (
+	batchConverted batchStatus = "converted"
+	batchPartial   batchStatus = "partial"
+	batchFailed    batchStatus = "failed"
+	batchSkipped   batchStatus = "skipped"
+)
+
+type batchResult struct {
+	id      string
+	title   string
+	status  batchStatus
+	details string
+	kind    compiler.ErrorKind
+}
+
+func runBatchCommand(batch *batchArgs, commandArgs []string) error {
+	parser, err := arg.NewParser(arg.Config{Program: "wpe-compile batch"}, batch)
+	if err != nil {
+		return err
+	}
+	err = parser.Parse(commandArgs)
+	if errors.Is(err, arg.ErrHelp) {
+		parser.WriteHelp(os.Stdout)
+		return nil
+	}
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+
+	console, err := newConsoleOutput(batch.Progress)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(batch.Input)
+	if err != nil {
+		return compiler.NewError(compiler.InputError, err)
+	}
+	if err := os.MkdirAll(batch.Output, 0755); err != nil {
+		return compiler.NewError(compiler.OutputError, err)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	results := []batchResult{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		itemDir := filepath.Join(batch.Input, entry.Name())
+		console.itemStarted(entry.Name())
+		result := convertBatchItem(ctx, console, batch, entry.Name(), itemDir)
+		if ctx.Err() != nil {
+			break
+		}
+		console.itemFinished(result)
+		results = append(results, result)
+	}
+
+	console.batchSummary(results)
+	if ctx.Err() != nil {
+		return compiler.NewError(compiler.CanceledError, errors.New("batch was interrupted"))
+	}
+	return batchError(results)
+}
+
+// batchError returns an error with the kind of the first failed item if any item failed, so that the exit code
+// tells what went wrong like it does for a single conversion.
+func batchError(results []batchResult) error {
+	failed := 0
+	kind := compiler.ErrorKind(0)
+	for _, result := range results {
+		if result.status != batchFailed {
+			continue
+		}
+		failed++
+		if kind == 0 {
+			kind = result.kind
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return compiler.NewError(kind, fmt.Errorf("%d of %d items failed", failed, len(results)))
+}
+
+func convertBatchItem(ctx context.Context, console *consoleOutput, batch *batchArgs, id string, itemDir string) (result batchResult) {
+	result = batchResult{id: id}
+
+	projectPath := filepath.Join(itemDir, "project.json")
+	projectBytes, err := os.ReadFile(projectPath)
+	if err != nil {
+		result.status = batchFailed
+		result.details = "cannot read project.json: " + err.Error()
+		result.kind = compiler.InputError
+		return result
+	}
+	project := compiler.Project{}
+	if err := json.Unmarshal(projectBytes, &project); err != nil {
+		result.status = batchFailed
+		result.details = "cannot parse project.json: " + err.Error()
+		result.kind = compiler.InputError
+		return result
+	}
+	result.title = project.Title
+
+	input := itemDir
+	if strings.HasSuffix(strings.ToLower(project.File), ".pkg") {
+		input = filepath.Join(itemDir, filepath.FromSlash(project.File))
+	}
+	output := filepath.Join(batch.Output, id+".owf")
+	if info, err := os.Stat(output); !batch.Overwrite && err == nil && info.Mode().IsRegular() {
+		result.status = batchSkipped
+		result.details = "output already exists"
+		return result
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result.status = batchFailed
+			result.details = fmt.Sprintf("internal error: %v", recovered)
+		}
+	}()
+	options := compileOptions(console, input, projectPath, batch.Assets, batch.Particles)
+	options.TaskTimeout = batch.TaskTimeout
+	options.Jobs = batch.Jobs
+	if batch.Module != "" {
+		options.Module = batch.Module
+	}
+	options.CacheDir = cacheDir(batch.CacheDir, batch.NoCache)
+	compiled, err := compile(ctx, console, options, output)
+	if errors.Is(err, compiler.ErrUnsupportedProject) {
+		result.status = batchSkipped
+		result.details = err.Error()
+		return result
+	}
+	if err != nil {
+		result.status = batchFailed
+		result.details = err.Error()
+		result.kind = compiler.KindOf(err)
+		return result
+	}
+
+	result.status = batchConverted
+	if details := describeSkipCounts(compiled.Skipped); details != "" {
+		result.status = batchPartial
+		result.details = details
+	}
+	return result
+}
+
+func describeSkipCounts(skipped compiler.SkipCounts) string {
+	parts := []string{}
+	appendCount := func(count int, noun string) {
+		switch count {
+		case 0:
+		case 1:
+			parts = append(parts, fmt.Sprintf("1 %s", noun))
+		default:
+			parts = append(parts, fmt.Sprintf("%d %ss", count, noun))
+		}
+	}
+	appendCount(skipped.Objects, "object")
+	appendCount(skipped.Effects, "effect")
+	appendCount(skipped.Shaders, "shader")
+	appendCount(skipped.Textures, "texture")
+	if len(parts) == 0 {
+		return ""
+	}
+	return "skipped " + strings.Join(parts, ", ")
+}
+
+// itemStarted and itemFinished print the start and the result of a batch item, as item_started and item_finished
+// events in json mode.
+func (console *consoleOutput) itemStarted(id string) {
+	if console.mode == progressJSON {
+		console.printJSON(map[string]string{"event": "item_started", "id": id})
+		return
+	}
+	fmt.Printf("==> %s\n", id)
+}
+
+func (console *consoleOutput) itemFinished(result batchResult) {
+	if console.mode == progressJSON {
+		console.printJSON(map[string]string{
+			"event":   "item_finished",
+			"id":      result.id,
+			"title":   result.title,
+			"status":  string(result.status),
+			"details": result.details,
+		})
+		return
+	}
+	if result.status == batchFailed {
+		fmt.Printf("error: %s\n", result.details)
+	}
+}
+
+// batchSummary prints a table of the results and the number of items with every status, or only the numbers as a
+// batch_finished event in json mode.
+func (console *consoleOutput) batchSummary(results []batchResult) {
+	counts := map[batchStatus]int{}
+	for _, result := range results {
+		counts[result.status]++
+	}
+	if console.mode == progressJSON {
+		event := map[string]any{"event": "batch_finished"}
+		for _, status := range []batchStatus{batchConverted, batchPartial, batchFailed, batchSkipped} {
+			event[string(status)] = counts[status]
+		}
+		console.printJSON(event)
+		return
+	}
+
+	fmt.Println()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSTATUS\tTITLE\tDETAILS")
+	for _, result := range results {
+		details := strings.ReplaceAll(result.details, "\n", " ")
+		if runes := []rune(details); len(runes) > 120 {
+			details = string(runes[:117]) + "..."
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.id, result.status, result.title, details)
+	}
+	_ = writer.Flush()
+
+	summary := []string{}
+	for _, status := range []batchStatus{batchConverted, batchPartial, batchFailed, batchSkipped} {
+		summary = append(summary, fmt.Sprintf("%s: %d", status, counts[status]))
+	}
+	fmt.Printf("\n%s\n", strings.Join(summary, ", "))
+}
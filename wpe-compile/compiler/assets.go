@@ -0,0 +1,168 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+type assetLayer interface {
+	name() string
+	readFile(path string) ([]byte, error)
+	hasFile(path string) bool
+}
+
+// AssetSource tells which layer a file was loaded from and which lower layers have the same file.
+type AssetSource struct {
+	Path      string
+	Layer     string
+	Overrides []string
+}
+
+// AssetFS looks up scene files in the project directory, scene.pkg and asset roots, in that order.
+type AssetFS struct {
+	layers  []assetLayer
+	sources map[string]AssetSource
+	mutex   sync.Mutex
+}
+
+func (assets *AssetFS) addLayer(layer assetLayer) {
+	assets.layers = append(assets.layers, layer)
+}
+
+func (assets *AssetFS) Close() {
+	for _, layer := range assets.layers {
+		if closer, ok := layer.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// Warnings returns why layers may have been misread, like a pkg of an unknown version.
+func (assets *AssetFS) Warnings() []string {
+	warnings := []string{}
+	for _, layer := range assets.layers {
+		if pkg, ok := layer.(*PkgReader); ok && pkg.Warning() != "" {
+			warnings = append(warnings, pkg.Warning())
+		}
+	}
+	return warnings
+}
+
+func (assets *AssetFS) ReadFile(path string) ([]byte, error) {
+	for layerIdx, layer := range assets.layers {
+		for _, candidate := range assetPathCandidates(path) {
+			data, err := layer.readFile(candidate)
+			if err == nil {
+				assets.recordSource(path, layerIdx)
+				return data, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("%s: %w", layer.name(), err)
+			}
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func assetPathCandidates(path string) []string {
+	return []string{path, "/assets/" + path, "assets/" + path}
+}
+
+func (assets *AssetFS) recordSource(path string, layerIdx int) {
+	assets.mutex.Lock()
+	defer assets.mutex.Unlock()
+	if _, exists := assets.sources[path]; exists {
+		return
+	}
+	if assets.sources == nil {
+		assets.sources = map[string]AssetSource{}
+	}
+
+	source := AssetSource{Path: path, Layer: assets.layers[layerIdx].name()}
+	for _, shadowed := range assets.layers[layerIdx+1:] {
+		for _, candidate := range assetPathCandidates(path) {
+			if shadowed.hasFile(candidate) {
+				source.Overrides = append(source.Overrides, shadowed.name())
+				break
+			}
+		}
+	}
+	assets.sources[path] = source
+}
+
+// Layers returns the names of the layers files are looked up in, from the top one.
+func (assets *AssetFS) Layers() []string {
+	layers := []string{}
+	for _, layer := range assets.layers {
+		layers = append(layers, layer.name())
+	}
+	return layers
+}
+
+// Sources returns where every file read so far was loaded from, sorted by path.
+func (assets *AssetFS) Sources() []AssetSource {
+	assets.mutex.Lock()
+	defer assets.mutex.Unlock()
+	sources := []AssetSource{}
+	for _, path := range slices.Sorted(maps.Keys(assets.sources)) {
+		sources = append(sources, assets.sources[path])
+	}
+	return sources
+}
+
+func OpenAssets(input string, assetRoots []string) (*AssetFS, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+
+	projectDir := ""
+	pkgPath := ""
+	if info.IsDir() {
+		projectDir = input
+		if candidate := filepath.Join(input, "scene.pkg"); isRegularFile(candidate) {
+			pkgPath = candidate
+		}
+	} else {
+		// Loose files next to a pkg only override its contents when the project.json there describes the pkg,
+		// otherwise the pkg was just put in some unrelated directory.
+		pkgPath = input
+		if projectPath := filepath.Join(filepath.Dir(input), "project.json"); isRegularFile(projectPath) {
+			if project, err := loadProject(projectPath); err == nil && projectNamesInput(project, input) {
+				projectDir = filepath.Dir(input)
+			}
+		}
+	}
+
+	assets := &AssetFS{}
+	if projectDir != "" {
+		project, err := openProjectDir(projectDir, pkgPath != "")
+		if err != nil {
+			return nil, err
+		}
+		assets.addLayer(project)
+	}
+	if pkgPath != "" {
+		pkg, err := OpenPkg(pkgPath, filepath.Base(pkgPath))
+		if err != nil {
+			return nil, fmt.Errorf("open pkg failed: %w", err)
+		}
+		assets.addLayer(pkg)
+	}
+	for _, root := range assetRoots {
+		assets.addLayer(&dirLayer{label: "assets " + root, root: root})
+	}
+	return assets, nil
+}
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,196 @@
+package compiler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+)
+
+// cacheFormatVersion is part of every cache key, bump it when cached values or their inputs change meaning.
+const cacheFormatVersion = 2
+
+// buildCache keeps converted textures and compiled shaders on disk between runs. Entries are gob files named by
+// a hash of everything the result depends on, so they never have to be invalidated. A nil cache is disabled.
+type buildCache struct {
+	dir string
+}
+
+type cachedShader struct {
+	GLSLCVersion  string
+	Shader        PreprocessedShader
+	VertexSPIRV   []byte
+	FragmentSPIRV []byte
+}
+
+func openBuildCache(dir string) *buildCache {
+	if _, ok := cacheBuildID(); dir == "" || !ok {
+		return nil
+	}
+	return &buildCache{dir: dir}
+}
+
+// key hashes parts with their lengths, so that moving bytes between parts changes the key.
+func (cache *buildCache) key(kind string, parts ...[]byte) string {
+	hash := sha256.New()
+	_ = binary.Write(hash, binary.LittleEndian, uint32(cacheFormatVersion))
+	buildID, _ := cacheBuildID()
+	for _, part := range append([][]byte{[]byte(buildID), []byte(kind)}, parts...) {
+		_ = binary.Write(hash, binary.LittleEndian, uint64(len(part)))
+		hash.Write(part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// cacheBuildID identifies the compiler in cache keys. A released version of the compiler module is identified by its
+// version and checksum only, so rebuilding a program that embeds it keeps the cache. Any other build, go run, go test,
+// a dirty tree or a replaced module, may have changed code under the same version, so the hash of the running
+// executable is added. If the executable cannot be hashed, ok is false and the cache is not used.
+var cacheBuildID = sync.OnceValues(func() (id string, ok bool) {
+	info, hasInfo := debug.ReadBuildInfo()
+	release := false
+	id = "(devel)"
+	if hasInfo {
+		id, release = moduleBuildID(info)
+	}
+	if release {
+		return id, true
+	}
+	executableHash, err := hashExecutable()
+	if err != nil {
+		return "", false
+	}
+	return id + " " + executableHash, true
+})
+
+// moduleBuildID returns the version of the compiler module in info and whether it is a released or pseudo-version
+// that identifies the code. Source builds are described by their VCS revision.
+func moduleBuildID(info *debug.BuildInfo) (string, bool) {
+	module := &info.Main
+	if info.Main.Path != modulePath {
+		module = nil
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				module = dep
+				if dep.Replace != nil {
+					module = dep.Replace
+				}
+				break
+			}
+		}
+	}
+	if module != nil && module.Version != "" && module.Version != "(devel)" && module.Sum != "" {
+		return module.Version + " " + module.Sum, true
+	}
+	if module != &info.Main {
+		return "(devel)", false
+	}
+
+	settings := map[string]string{}
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if settings["vcs.revision"] == "" {
+		return "(devel)", false
+	}
+	id := "(devel) " + settings["vcs.revision"]
+	if settings["vcs.modified"] == "true" {
+		id += " modified"
+	}
+	return id, false
+}
+
+func hashExecutable() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return hashFile(executable)
+}
+
+func (cache *buildCache) path(kind string, key string) string {
+	return filepath.Join(cache.dir, kind, key[:2], key)
+}
+
+// load decodes the entry into value and reports whether it was found. Broken entries count as missing.
+func (cache *buildCache) load(kind string, key string, value any) bool {
+	if cache == nil {
+		return false
+	}
+	entryBytes, err := os.ReadFile(cache.path(kind, key))
+	if err != nil {
+		return false
+	}
+	return gob.NewDecoder(bytes.NewReader(entryBytes)).Decode(value) == nil
+}
+
+// store writes the entry to a temporary file first, so that concurrent runs never see a partial entry.
+func (cache *buildCache) store(kind string, key string, value any) error {
+	if cache == nil {
+		return nil
+	}
+	buffer := bytes.Buffer{}
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return err
+	}
+
+	entryPath := cache.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(entryPath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buffer.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), entryPath)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+// loadDir returns the directory of an entry that was stored with storeDir.
+func (cache *buildCache) loadDir(kind string, key string) (string, bool) {
+	if cache == nil {
+		return "", false
+	}
+	entryPath := cache.path(kind, key)
+	info, err := os.Stat(entryPath)
+	return entryPath, err == nil && info.IsDir()
+}
+
+// storeDir calls build with an empty directory next to the entry and moves it into place when build succeeds.
+// If another run stored the same entry in the meantime, its directory is used instead.
+func (cache *buildCache) storeDir(kind string, key string, build func(dir string) error) (string, error) {
+	entryPath := cache.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return "", err
+	}
+	buildDir, err := os.MkdirTemp(filepath.Dir(entryPath), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(buildDir)
+
+	if err := build(buildDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(buildDir, entryPath); err != nil {
+		if _, ok := cache.loadDir(kind, key); ok {
+			return entryPath, nil
+		}
+		return "", err
+	}
+	return entryPath, nil
+}
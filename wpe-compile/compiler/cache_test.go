@@ -0,0 +1,61 @@
+package compiler
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestModuleBuildID(t *testing.T) {
+	revision := []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}}
+	tests := []struct {
+		name     string
+		info     debug.BuildInfo
+		expected string
+		release  bool
+	}{
+		{"released", debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "v1.2.0", Sum: "h1:x"}},
+			"v1.2.0 h1:x", true},
+		{"source build", debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "(devel)"}, Settings: revision},
+			"(devel) abc123", false},
+		{"modified source build", debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "(devel)"},
+			Settings: append(revision, debug.BuildSetting{Key: "vcs.modified", Value: "true"})}, "(devel) abc123 modified", false},
+		{"source build without vcs", debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "(devel)"}},
+			"(devel)", false},
+		{"dependency", debug.BuildInfo{
+			Main:     debug.Module{Path: "example.com/host", Version: "(devel)"},
+			Deps:     []*debug.Module{{Path: modulePath, Version: "v0.0.0-20260101000000-abcdef123456", Sum: "h1:y"}},
+			Settings: revision,
+		}, "v0.0.0-20260101000000-abcdef123456 h1:y", true},
+		{"replaced dependency", debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/host", Version: "(devel)"},
+			Deps: []*debug.Module{{Path: modulePath, Version: "v1.0.0",
+				Replace: &debug.Module{Path: "../wpe-compile"}}},
+			Settings: revision,
+		}, "(devel)", false},
+		{"host source build", debug.BuildInfo{Main: debug.Module{Path: "example.com/host", Version: "(devel)"},
+			Settings: revision}, "(devel)", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, release := moduleBuildID(&test.info)
+			if id != test.expected || release != test.release {
+				t.Errorf("moduleBuildID() = %q, %v, want %q, %v", id, release, test.expected, test.release)
+			}
+		})
+	}
+}
+
+func TestCacheBuildIDOfTestBinary(t *testing.T) {
+	id, ok := cacheBuildID()
+	if !ok {
+		t.Fatal("cache is disabled for the test binary")
+	}
+	executableHash, err := hashExecutable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(id, " "+executableHash) {
+		t.Errorf("build id %q of a development build does not contain the executable hash %s", id, executableHash)
+	}
+}
@@ -0,0 +1,1584 @@
+package compiler
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ImportTextureTask struct {
+	// in
+	Name string
+	ID   int
+
+	// out
+	Error               error
+	Cached              bool
+	Width               int
+	Height              int
+	Format              texFormat
+	ClampUV             bool
+	Interpolation       bool
+	SpritesheetCols     int
+	SpritesheetRows     int
+	SpritesheetFrames   int
+	SpritesheetDuration float32
+}
+
+type CompileShaderTask struct {
+	// in
+	Name          string
+	BuiltIn       string
+	Preprocess    bool
+	Defines       map[string]int
+	BoundTextures []bool
+	ID            int
+
+	// out
+	Error            error
+	Cached           bool
+	VertexUniforms   []UniformInfo
+	FragmentUniforms []UniformInfo
+	Attributes       []AttributeInfo
+	Samplers         []SamplerInfo
+}
+
+// SkipCounts counts scene parts that were dropped because they are unsupported or failed to convert.
+type SkipCounts struct {
+	Objects  int
+	Effects  int
+	Shaders  int
+	Textures int
+}
+
+// Options configure a single Compile call. Input is required, scenes also need AssetRoots and either Module
+// or WasmCC. If OutputPath is set, the archive is written there instead of being returned in Result.Output.
+type Options struct {
+	Input         string
+	OutputPath    string
+	Project       string
+	AssetRoots    []string
+	WasmCC        string
+	SkipParticles bool
+	KeepSources   bool
+	ListObjects   bool
+	SkipObjects   string
+	SkipEffects   string
+	Overrides     UserOverrides
+
+	// Module is a scene module built by BuildModule. It is used as is, so WasmCC is not needed if it is set.
+	Module string
+
+	// TaskTimeout limits every glslc and WASM C compiler run, DefaultTaskTimeout is used if it is zero.
+	TaskTimeout time.Duration
+
+	// CacheDir keeps converted textures and compiled shaders between calls, caching is disabled if it is empty.
+	CacheDir string
+
+	// Timestamp is the modification time of archive entries, 1980-01-01 is used if it is zero or earlier and
+	// 2107-12-31 if it is later.
+	Timestamp time.Time
+
+	// Jobs is how many tasks run in parallel, runtime.NumCPU() is used if it is zero.
+	Jobs int
+
+	// Warn, Progress and TaskEvent are optional, they are never called concurrently for the same Compile call.
+	Warn      func(message string)
+	Progress  func(done int, total int, description string)
+	TaskEvent func(event TaskEvent)
+}
+
+type TaskEventType string
+
+const (
+	TaskStarted  TaskEventType = "task_started"
+	TaskFinished TaskEventType = "task_finished"
+)
+
+// TaskEvent is sent when a texture import or shader compile task starts or finishes. Task is the index
+// of the task, Done is how many tasks have finished, Total grows as tasks for later stages are added.
+type TaskEvent struct {
+	Event  TaskEventType `json:"event"`
+	Task   int           `json:"task"`
+	Done   int           `json:"done"`
+	Total  int           `json:"total"`
+	Kind   string        `json:"kind"`
+	Name   string        `json:"name"`
+	Error  string        `json:"error,omitempty"`
+	Cached bool          `json:"cached,omitempty"`
+}
+
+// Result is the converted wallpaper. Output is nil when only objects were listed or OutputPath was set.
+type Result struct {
+	Output       []byte
+	Objects      []ObjectInfo
+	AssetLayers  []string
+	AssetSources []AssetSource
+	Skipped      SkipCounts
+	Report       Report
+	Warnings     []string
+}
+
+const DefaultTaskTimeout = 5 * time.Minute
+
+var (
+	ErrNoAssetRoots = errors.New("no asset roots are given")
+	ErrNoWasmCC     = errors.New("WASM C compiler is not given")
+	// ErrUnsupportedProject is returned for a project type that is neither a scene nor a video and has no
+	// scene.json to fall back to.
+	ErrUnsupportedProject = errors.New("unsupported project type")
+)
+
+type compileJob struct {
+	ctx           context.Context
+	options       Options
+	assets        *AssetFS
+	assetLayers   []string
+	assetSources  []AssetSource
+	scene         Scene
+	objects       []ObjectInfo
+	objectIndexes map[SceneObject]int
+	report        Report
+	tasks         []any
+	archive       *archive
+	cache         *buildCache
+	outputErr     error
+	output        []byte
+	skipped       SkipCounts
+	warnings      []string
+	glslcOnce     sync.Once
+	glslcVersion  string
+	glslcErr      error
+	mutex         sync.Mutex
+	logMutex      sync.Mutex
+}
+
+//go:embed module/main.c
+var mainCode []byte
+
+//go:embed module/renderer.c
+var rendererCode []byte
+
+//go:embed module/common.c
+var commonCode []byte
+
+//go:embed module/uniform.c
+var uniformCode []byte
+
+//go:embed module/image.c
+var imageCode []byte
+
+//go:embed module/puppet.c
+var puppetCode []byte
+
+//go:embed module/particle.c
+var particleCode []byte
+
+//go:embed module/transform.c
+var transformCode []byte
+
+//go:embed module/scene_data.c
+var sceneDataCode []byte
+
+//go:embed module/defs.h
+var defsCode []byte
+
+//go:embed module/particle_vertex.glsl
+var particleVertexGLSL []byte
+
+//go:embed module/particle_fragment.glsl
+var particleFragmentGLSL []byte
+
+// Compile converts a Wallpaper Engine scene or video project into an OpenWallpaper .owf archive.
+// Calls share no state, so several conversions can run at the same time.
+func Compile(ctx context.Context, options Options) (*Result, error) {
+	spoolDir := ""
+	if options.OutputPath != "" {
+		spoolDir = filepath.Dir(options.OutputPath)
+	}
+	archive, err := newArchive(spoolDir)
+	if err != nil {
+		return nil, NewError(OutputError, fmt.Errorf("creating spool file failed: %w", err))
+	}
+	defer archive.close()
+
+	job := &compileJob{
+		ctx:     ctx,
+		options: options,
+		archive: archive,
+		cache:   openBuildCache(options.CacheDir),
+	}
+	if err := job.compileWallpaper(); err != nil {
+		return nil, err
+	}
+	return &Result{
+		Output:       job.output,
+		Objects:      job.objects,
+		AssetLayers:  job.assetLayers,
+		AssetSources: job.assetSources,
+		Skipped:      job.skipped,
+		Report:       job.report,
+		Warnings:     job.warnings,
+	}, nil
+}
+
+func (job *compileJob) warnf(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	job.logMutex.Lock()
+	defer job.logMutex.Unlock()
+	job.warnings = append(job.warnings, message)
+	if job.options.Warn != nil {
+		job.options.Warn(message)
+	}
+}
+
+func (job *compileJob) progress(done int, total int, description string) {
+	if job.options.Progress == nil {
+		return
+	}
+	job.logMutex.Lock()
+	defer job.logMutex.Unlock()
+	job.options.Progress(done, total, description)
+}
+
+// addOutput adds a file to the output archive. A failure is kept and returned when the archive is written.
+func (job *compileJob) addOutput(name string, data []byte) {
+	if err := job.archive.add(name, data); err != nil {
+		job.mutex.Lock()
+		job.outputErr = cmp.Or(job.outputErr, err)
+		job.mutex.Unlock()
+	}
+}
+
+// writeOutput writes the archive to OutputPath, or keeps it in memory for Result.Output if there is no path.
+func (job *compileJob) writeOutput() error {
+	if job.outputErr != nil {
+		return NewError(OutputError, job.outputErr)
+	}
+	if job.options.OutputPath != "" {
+		if err := job.archive.writeZipFile(job.options.OutputPath, job.options.Timestamp); err != nil {
+			return NewError(OutputError, fmt.Errorf("write output failed: %w", err))
+		}
+		return nil
+	}
+	buffer := bytes.Buffer{}
+	if err := job.archive.writeZip(&buffer, job.options.Timestamp); err != nil {
+		return NewError(OutputError, fmt.Errorf("zip failed: %w", err))
+	}
+	job.output = buffer.Bytes()
+	return nil
+}
+
+func (job *compileJob) taskEvent(event TaskEvent) {
+	if job.options.TaskEvent == nil {
+		return
+	}
+	job.logMutex.Lock()
+	defer job.logMutex.Unlock()
+	job.options.TaskEvent(event)
+}
+
+func (job *compileJob) compileScene(projectPath string) error {
+	if len(job.options.AssetRoots) == 0 {
+		return NewError(ToolchainError, ErrNoAssetRoots)
+	}
+	if job.options.Module == "" && job.options.WasmCC == "" {
+		return NewError(ToolchainError, ErrNoWasmCC)
+	}
+
+	var err error
+	job.assets, err = OpenAssets(job.options.Input, job.options.AssetRoots)
+	if err != nil {
+		return NewError(InputError, fmt.Errorf("open input failed: %w", err))
+	}
+	defer job.assets.Close()
+	job.assetLayers = job.assets.Layers()
+	defer func() {
+		job.assetSources = job.assets.Sources()
+	}()
+	for _, warning := range job.assets.Warnings() {
+		job.warnf("%s", warning)
+	}
+
+	job.scene, err = ParseScene(job.assets, job.options.Overrides)
+	if err != nil {
+		return NewError(ParseError, fmt.Errorf("parse scene.json failed: %w", err))
+	}
+	for objectIndex, object := range job.scene.Objects {
+		job.objects = append(job.objects, sceneObjectInfo(objectIndex, object))
+	}
+	job.initReport()
+
+	if job.options.ListObjects {
+		return nil
+	}
+	if job.options.Module != "" {
+		if !isRegularFile(job.options.Module) {
+			return NewError(InputError, fmt.Errorf("scene module %s does not exist", job.options.Module))
+		}
+	} else if _, err := exec.LookPath(job.options.WasmCC); err != nil {
+		return NewError(ToolchainError, fmt.Errorf("WASM C compiler is not usable: %w", err))
+	}
+	if job.options.SkipEffects != "" {
+		if err := job.applySkipEffects(job.options.SkipEffects); err != nil {
+			return NewError(InputError, fmt.Errorf("invalid effect skip list: %w", err))
+		}
+	}
+	if job.options.SkipObjects != "" {
+		if err := job.applySkipObjects(job.options.SkipObjects); err != nil {
+			return NewError(InputError, fmt.Errorf("invalid object skip list: %w", err))
+		}
+	}
+
+	if err := job.preprocessScene(); err != nil {
+		return NewError(CanceledError, fmt.Errorf("compilation canceled: %w", err))
+	}
+	if err := job.glslcFailure(); err != nil {
+		return NewError(ToolchainError, err)
+	}
+	job.makeMetadata(projectPath, job.options.Input, job.options.Overrides)
+
+	sceneData := encodeSceneData(job.scene)
+	job.addOutput(sceneDataFile, sceneData)
+	wasmBytes, err := job.sceneModule()
+	if err != nil {
+		return err
+	}
+	wasmBytes, err = job.limitModuleMemory(wasmBytes, len(sceneData))
+	if err != nil {
+		return err
+	}
+	job.checkModuleStack()
+	job.addOutput("scene.wasm", wasmBytes)
+	return job.writeOutput()
+}
+
+// preprocessScene prepares objects for the scene data and runs their tasks. It only fails if the job is canceled.
+func (job *compileJob) preprocessScene() error {
+	job.tasks = []any{}
+	job.scene.Types = []int{}
+	job.scene.Shaders = nil
+	job.scene.Textures = nil
+	job.scene.PassthroughShader = -1
+	job.scene.AudioSpectrumSize = 0
+
+	needsPassthroughShader := false
+	for _, object := range job.scene.Objects {
+		if imageObject, ok := object.(*ImageObject); ok {
+			job.processImageObject(imageObject)
+			needsPassthroughShader = true
+			job.scene.Types = append(job.scene.Types, 0)
+		} else if particleObject, ok := object.(*ParticleObject); ok {
+			if job.options.SkipParticles {
+				job.reportObject(particleObject, ReportSkipped, "particles are disabled")
+				job.scene.Types = append(job.scene.Types, 2)
+			} else if job.processParticleObject(particleObject) {
+				needsPassthroughShader = true
+				job.scene.Types = append(job.scene.Types, 1)
+			} else {
+				job.scene.Types = append(job.scene.Types, 2)
+			}
+		} else {
+			job.scene.Types = append(job.scene.Types, 2)
+		}
+	}
+
+	if needsPassthroughShader {
+		job.scene.PassthroughShader = job.addCompileShaderTask(&CompileShaderTask{
+			Name:          "passthrough",
+			Preprocess:    true,
+			Defines:       map[string]int{"TRANSFORM": 1},
+			BoundTextures: []bool{true},
+		})
+	}
+
+	if err := job.executeTasksFrom(0); err != nil {
+		return err
+	}
+	particleShaderTaskStart := len(job.tasks)
+	job.addParticleShaderTasks()
+	if err := job.executeTasksFrom(particleShaderTaskStart); err != nil {
+		return err
+	}
+
+	firstTaskCount := len(job.tasks)
+	job.addSamplerDefaultTextureTasks()
+	if err := job.executeTasksFrom(firstTaskCount); err != nil {
+		return err
+	}
+	job.collectSceneTaskResults()
+	job.finishReport()
+	return nil
+}
+
+// ObjectInfo describes a scene object as it was parsed, Index is what object skip lists refer to.
+type ObjectInfo struct {
+	Index   int
+	ID      int
+	Parent  int
+	Name    string
+	Type    string
+	Effects []EffectInfo
+}
+
+type EffectInfo struct {
+	Name   string
+	Passes int
+}
+
+func sceneObjectInfo(index int, object SceneObject) ObjectInfo {
+	switch object := object.(type) {
+	case *ImageObject:
+		effects := []EffectInfo{}
+		for _, effect := range object.Effects {
+			effects = append(effects, EffectInfo{Name: effectDisplayName(effect), Passes: len(effect.Passes)})
+		}
+		return ObjectInfo{
+			Index:   index,
+			ID:      object.ID,
+			Parent:  object.Parent,
+			Name:    object.Name,
+			Type:    "image",
+			Effects: effects,
+		}
+	case *ParticleObject:
+		return ObjectInfo{
+			Index:  index,
+			ID:     object.ID,
+			Parent: object.Parent,
+			Name:   object.Name,
+			Type:   "particle",
+		}
+	case *EmptyObject:
+		return ObjectInfo{
+			Index:  index,
+			ID:     object.ID,
+			Parent: object.Parent,
+			Name:   "",
+			Type:   "empty",
+		}
+	default:
+		return ObjectInfo{
+			Index:  index,
+			Parent: -1,
+			Type:   "unknown",
+		}
+	}
+}
+
+func effectDisplayName(effect ImageEffect) string {
+	effectPath := strings.TrimSpace(effect.Path)
+	if effectPath != "" {
+		effectPath = strings.TrimSuffix(effectPath, "/effect.json")
+		effectPath = strings.TrimSuffix(effectPath, "/")
+		if slash := strings.LastIndexByte(effectPath, '/'); slash >= 0 {
+			effectPath = effectPath[slash+1:]
+		}
+		if effectPath != "" {
+			return effectPath
+		}
+	}
+	return effect.Name
+}
+
+func (job *compileJob) applySkipObjects(spec string) error {
+	selectors, err := parseIndexRanges(spec, func(r rune) bool {
+		return r == ',' || r == ';' || r == '\n'
+	})
+	if err != nil {
+		return err
+	}
+
+	skippedIndexes := map[int]bool{}
+	skippedIDs := map[int]bool{}
+	for objectIndex, object := range job.scene.Objects {
+		info := sceneObjectInfo(objectIndex, object)
+		if indexRangesMatch(selectors, objectIndex) {
+			skippedIndexes[objectIndex] = true
+			skippedIDs[info.ID] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for objectIndex, object := range job.scene.Objects {
+			if skippedIndexes[objectIndex] {
+				continue
+			}
+			info := sceneObjectInfo(objectIndex, object)
+			if info.Parent >= 0 && skippedIDs[info.Parent] {
+				skippedIndexes[objectIndex] = true
+				skippedIDs[info.ID] = true
+				changed = true
+			}
+		}
+	}
+
+	filteredObjects := job.scene.Objects[:0]
+	for objectIndex, object := range job.scene.Objects {
+		if skippedIndexes[objectIndex] {
+			job.reportObject(object, ReportSkipped, "excluded by object skip list")
+			continue
+		}
+		filteredObjects = append(filteredObjects, object)
+	}
+	job.scene.Objects = filteredObjects
+	return nil
+}
+
+type indexRange struct {
+	start int
+	end   int
+}
+
+type effectSkipRule struct {
+	objectRanges []indexRange
+	effectRanges []indexRange
+}
+
+func (job *compileJob) applySkipEffects(spec string) error {
+	rules, err := parseEffectSkipRules(spec)
+	if err != nil {
+		return err
+	}
+	for objectIndex, object := range job.scene.Objects {
+		imageObject, ok := object.(*ImageObject)
+		if !ok {
+			continue
+		}
+		filteredEffects := imageObject.Effects[:0]
+		for effectIndex, effect := range imageObject.Effects {
+			skip := false
+			for _, rule := range rules {
+				if effectRuleMatches(rule, objectIndex, effectIndex) {
+					skip = true
+					break
+				}
+			}
+			if skip {
+				job.reportEffect(&effect, ReportSkipped, "excluded by effect skip list")
+				continue
+			}
+			filteredEffects = append(filteredEffects, effect)
+		}
+		imageObject.Effects = filteredEffects
+	}
+	return nil
+}
+
+func parseEffectSkipRules(spec string) ([]effectSkipRule, error) {
+	clauses := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ';' || r == '\n'
+	})
+	rules := []effectSkipRule{}
+	for _, clause := range clauses {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		objectSpec, effectSpec, found := strings.Cut(clause, ":")
+		if !found {
+			return nil, fmt.Errorf("rule %q must use object-index:effect-indices", clause)
+		}
+		objectRanges, err := parseIndexRanges(objectSpec, func(r rune) bool {
+			return r == ','
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rule %q has invalid object indices: %w", clause, err)
+		}
+		effectRanges, err := parseIndexRanges(effectSpec, func(r rune) bool {
+			return r == ','
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rule %q has invalid effect indices: %w", clause, err)
+		}
+		rules = append(rules, effectSkipRule{
+			objectRanges: objectRanges,
+			effectRanges: effectRanges,
+		})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("empty effect skip spec")
+	}
+	return rules, nil
+}
+
+func effectRuleMatches(rule effectSkipRule, objectIndex int, effectIndex int) bool {
+	return indexRangesMatch(rule.objectRanges, objectIndex) && indexRangesMatch(rule.effectRanges, effectIndex)
+}
+
+func parseIndexRanges(spec string, split func(rune) bool) ([]indexRange, error) {
+	parts := strings.FieldsFunc(spec, split)
+	ranges := []indexRange{}
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		indexRange, err := parseIndexRange(part)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, indexRange)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("empty index list")
+	}
+	return ranges, nil
+}
+
+func parseIndexRange(spec string) (indexRange, error) {
+	spec = strings.TrimSpace(spec)
+	if before, after, found := strings.Cut(spec, "-"); found {
+		start, startErr := strconv.Atoi(strings.TrimSpace(before))
+		end, endErr := strconv.Atoi(strings.TrimSpace(after))
+		if startErr != nil || endErr != nil || start < 0 || end < 0 {
+			return indexRange{}, fmt.Errorf("invalid index range %q", spec)
+		}
+		if start > end {
+			start, end = end, start
+		}
+		return indexRange{start: start, end: end}, nil
+	}
+	index, err := strconv.Atoi(spec)
+	if err != nil || index < 0 {
+		return indexRange{}, fmt.Errorf("invalid index %q", spec)
+	}
+	return indexRange{start: index, end: index}, nil
+}
+
+func indexRangesMatch(ranges []indexRange, index int) bool {
+	for _, indexRange := range ranges {
+		if index >= indexRange.start && index <= indexRange.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (job *compileJob) processImageObject(object *ImageObject) {
+	if object.Puppet != nil && len(object.PuppetData) > 0 {
+		job.addOutput(object.Puppet.Path, object.PuppetData)
+	}
+
+	if object.ColorBlendMode != 0 {
+		effectPassthrough, err := job.makeEffectPassthrough(object.ColorBlendMode)
+		if err != nil {
+			job.warnf("skipping image object %s colorBlendMode because creating effectpassthrough failed: %s", object.Name, err)
+			failedEffect := ImageEffect{Name: "effectpassthrough"}
+			job.addReportEffect(job.objectIndexes[object], &failedEffect)
+			job.reportEffect(&failedEffect, ReportFailed, err.Error())
+			job.skipped.Effects++
+		} else {
+			job.addReportEffect(job.objectIndexes[object], &effectPassthrough)
+			object.Effects = append(object.Effects, effectPassthrough)
+		}
+	}
+
+	object.Material.ImportedTextures = make([]int, len(object.Material.Textures))
+	for idx := range object.Material.Textures {
+		object.Material.ImportedTextures[idx] = job.addImportTextureTask(&ImportTextureTask{Name: object.Material.Textures[idx]})
+	}
+	materialDefines := object.Material.Combos
+	if object.Puppet != nil && object.Puppet.BoneCount > 0 && len(object.Effects) == 0 {
+		materialDefines = puppetShaderDefines(materialDefines, object.Puppet)
+		object.Material.Combos = materialDefines
+	}
+	object.Material.CompiledShader = job.addCompileShaderTask(&CompileShaderTask{
+		Name:          object.Material.Shader,
+		Preprocess:    true,
+		Defines:       materialDefines,
+		BoundTextures: []bool{},
+	})
+
+	if object.Puppet != nil && object.Puppet.HasMesh && len(object.Effects) > 0 {
+		object.PuppetMaterial = cloneMaterial(object.Material)
+		if len(object.PuppetMaterial.Textures) > 0 {
+			object.PuppetMaterial.Textures[0] = ""
+		}
+		object.PuppetMaterial.ImportedTextures = make([]int, len(object.PuppetMaterial.Textures))
+		for idx := range object.PuppetMaterial.Textures {
+			object.PuppetMaterial.ImportedTextures[idx] = job.addImportTextureTask(&ImportTextureTask{Name: object.PuppetMaterial.Textures[idx]})
+		}
+		puppetDefines := object.PuppetMaterial.Combos
+		if object.Puppet.BoneCount > 0 {
+			puppetDefines = puppetShaderDefines(puppetDefines, object.Puppet)
+			object.PuppetMaterial.Combos = puppetDefines
+		}
+		object.PuppetMaterial.CompiledShader = job.addCompileShaderTask(&CompileShaderTask{
+			Name:          object.PuppetMaterial.Shader,
+			Preprocess:    true,
+			Defines:       puppetDefines,
+			BoundTextures: []bool{},
+		})
+	}
+	for effectIdx := range object.Effects {
+		effect := &object.Effects[effectIdx]
+		for materialIdx := range effect.Materials {
+			material := &effect.Materials[materialIdx]
+			var pass *MaterialPass
+			if materialIdx < len(effect.Passes) {
+				pass = &effect.Passes[materialIdx]
+			}
+			job.processEffectMaterial(material, pass)
+		}
+	}
+}
+
+func cloneMaterial(material Material) Material {
+	cloned := material
+	cloned.Textures = slices.Clone(material.Textures)
+	cloned.ImportedTextures = nil
+	cloned.CompiledShader = 0
+	if material.Combos != nil {
+		cloned.Combos = maps.Clone(material.Combos)
+	}
+	return cloned
+}
+
+func puppetShaderDefines(base map[string]int, puppet *PuppetMetadata) map[string]int {
+	defines := map[string]int{}
+	maps.Copy(defines, base)
+	defines["SKINNING"] = 1
+	defines["BONECOUNT"] = puppet.BoneCount
+	return defines
+}
+
+func (job *compileJob) processParticleObject(object *ParticleObject) bool {
+	if len(object.ParticleData.Material.Textures) == 0 {
+		job.dropObject(object, ReportSkipped, "no texture")
+		return false
+	}
+	if len(object.ParticleData.Renderers) != 1 || object.ParticleData.Renderers[0].Name != "sprite" {
+		rendererName := ""
+		if len(object.ParticleData.Renderers) > 0 {
+			rendererName = object.ParticleData.Renderers[0].Name
+		}
+		job.dropObject(object, ReportSkipped, "unsupported renderer "+rendererName)
+		return false
+	}
+	if object.ParticleData.MaxCount == 0 {
+		job.dropObject(object, ReportSkipped, "maxcount is zero")
+		return false
+	}
+
+	object.ParticleData.Material.ImportedTextures = []int{
+		job.addImportTextureTask(&ImportTextureTask{Name: object.ParticleData.Material.Textures[0]}),
+	}
+	object.ParticleData.Material.CompiledShader = -1
+	object.Perspective = object.ParticleData.Flags&ParticleFlagPerspective != 0
+
+	applyParticleInstanceOverride(object)
+
+	for i := range 3 {
+		if object.Scale[i] <= 0 {
+			object.Scale[i] = 1
+		}
+	}
+	if object.ParticleData.Flags&ParticleFlagWorldSpace != 0 {
+		scale := float32(math.Pow(float64(object.Scale[0]*object.Scale[1]*object.Scale[2]), -1.0/3.0))
+		object.ParticleData.Initializer.MinSize *= scale
+		object.ParticleData.Initializer.MaxSize *= scale
+	}
+	if object.ParticleData.Initializer.TurbulentVelocity && object.ParticleData.Initializer.TurbulentAudio.Mode != 0 &&
+		job.scene.AudioSpectrumSize < 16 {
+		job.scene.AudioSpectrumSize = 16
+	}
+
+	return true
+}
+
+// dropObject warns about an object that is left out of the scene and records why in the report.
+func (job *compileJob) dropObject(object SceneObject, status ReportStatus, reason string) {
+	info := job.objects[job.objectIndexes[object]]
+	job.warnf("skipping %s object %s: %s", info.Type, info.Name, reason)
+	job.reportObject(object, status, reason)
+	job.skipped.Objects++
+}
+
+func applyParticleInstanceOverride(object *ParticleObject) {
+	override := object.InstanceOverride
+	if !override.Enabled {
+		return
+	}
+
+	init := &object.ParticleData.Initializer
+	if override.Count != 0 {
+		object.ParticleData.MaxCount = uint32(float32(object.ParticleData.MaxCount) * override.Count)
+		for i := range object.ParticleData.Emitters {
+			object.ParticleData.Emitters[i].Rate *= override.Count
+		}
+	}
+	if override.OverrideColor {
+		for i := range 3 {
+			init.MinColor[i] = override.Color[i]
+			init.MaxColor[i] = override.Color[i]
+		}
+	}
+	if override.OverrideColorN {
+		for i := range 3 {
+			init.MinColor[i] *= override.ColorN[i]
+			init.MaxColor[i] *= override.ColorN[i]
+		}
+	}
+	if override.Lifetime != 0 {
+		init.MinLifetime *= override.Lifetime
+		init.MaxLifetime *= override.Lifetime
+	}
+	if override.Alpha != 0 {
+		init.MinAlpha *= override.Alpha
+		init.MaxAlpha *= override.Alpha
+	}
+	if override.Size != 0 {
+		init.MinSize *= override.Size
+		init.MaxSize *= override.Size
+	}
+	if override.Speed != 0 {
+		object.ParticleData.Operator.Movement.Speed *= override.Speed
+		for i := range init.MinVelocity {
+			init.MinVelocity[i] *= override.Speed
+			init.MaxVelocity[i] *= override.Speed
+		}
+		if init.TurbulentVelocity {
+			init.TurbulentSpeedMin *= override.Speed
+			init.TurbulentSpeedMax *= override.Speed
+		}
+	}
+	if override.Rate != 0 {
+		for i := range object.ParticleData.Emitters {
+			object.ParticleData.Emitters[i].Rate *= override.Rate
+		}
+	}
+}
+
+func (job *compileJob) addParticleShaderTasks() {
+	for objectIndex, object := range job.scene.Objects {
+		if objectIndex >= len(job.scene.Types) || job.scene.Types[objectIndex] != 1 {
+			continue
+		}
+		particleObject, ok := object.(*ParticleObject)
+		if !ok || len(particleObject.ParticleData.Material.ImportedTextures) == 0 {
+			continue
+		}
+		textureTaskID := particleObject.ParticleData.Material.ImportedTextures[0]
+		if textureTaskID < 0 || textureTaskID >= len(job.tasks) {
+			continue
+		}
+		textureTask, ok := job.tasks[textureTaskID].(*ImportTextureTask)
+		if !ok || textureTask.Error != nil {
+			continue
+		}
+
+		particleObject.SpritesheetCols = textureTask.SpritesheetCols
+		particleObject.SpritesheetRows = textureTask.SpritesheetRows
+		particleObject.SpritesheetFrames = textureTask.SpritesheetFrames
+		particleObject.TextureRatio = particleTextureRatio(textureTask)
+
+		particleObject.ParticleData.Material.CompiledShader = job.addCompileShaderTask(&CompileShaderTask{
+			Name:          "particle",
+			BuiltIn:       "particle",
+			Defines:       map[string]int{"TEX0_FORMAT": particleTextureFormatDefine(textureTask.Format)},
+			BoundTextures: []bool{true},
+		})
+	}
+}
+
+func particleTextureRatio(texture *ImportTextureTask) float32 {
+	textureRatio := float32(1)
+	frameWidth := float32(texture.Width)
+	frameHeight := float32(texture.Height)
+	if texture.SpritesheetCols > 0 && texture.SpritesheetRows > 0 {
+		frameWidth = float32(texture.Width) / float32(texture.SpritesheetCols)
+		frameHeight = float32(texture.Height) / float32(texture.SpritesheetRows)
+	}
+	if frameWidth != 0 {
+		textureRatio = frameHeight / frameWidth
+	}
+	return textureRatio
+}
+
+func particleTextureFormatDefine(format texFormat) int {
+	switch format {
+	case texFormatR8:
+		return 1
+	case texFormatRG88:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (job *compileJob) makeEffectPassthrough(colorBlendMode int) (ImageEffect, error) {
+	materialBytes, err := job.getAssetBytes("materials/util/effectpassthrough.json")
+	if err != nil {
+		return ImageEffect{}, fmt.Errorf("loading effectpassthrough material failed: %w", err)
+	}
+
+	var material Material
+	if err := material.parseFromJSON(materialBytes); err != nil {
+		return ImageEffect{}, fmt.Errorf("parsing effectpassthrough material failed: %w", err)
+	}
+
+	if material.Combos == nil {
+		material.Combos = map[string]int{}
+	}
+	material.Combos["BONECOUNT"] = 1
+	material.Combos["BLENDMODE"] = colorBlendMode
+	material.Blending = "disabled"
+
+	pass := MaterialPass{
+		Combos: map[string]int{
+			"BONECOUNT": 1,
+			"BLENDMODE": colorBlendMode,
+		},
+	}
+
+	return ImageEffect{
+		Name:      "effectpassthrough",
+		Passes:    []MaterialPass{pass},
+		Materials: []Material{material},
+	}, nil
+}
+
+func (job *compileJob) processEffectMaterial(material *Material, pass *MaterialPass) {
+	material.ImportedTextures = make([]int, len(material.Textures))
+	for idx := range material.Textures {
+		material.ImportedTextures[idx] = job.addImportTextureTask(&ImportTextureTask{Name: material.Textures[idx]})
+	}
+
+	defines := material.Combos
+	boundTextures := make([]bool, len(material.Textures))
+	for slot, textureName := range material.Textures {
+		if textureName != "" {
+			boundTextures[slot] = true
+		}
+	}
+	if pass != nil {
+		pass.ImportedTextures = make([]int, len(pass.Textures))
+		for idx := range pass.Textures {
+			pass.ImportedTextures[idx] = job.addImportTextureTask(&ImportTextureTask{Name: pass.Textures[idx]})
+		}
+		defines = pass.Combos
+		boundTextures = getEffectBoundTextures(material, pass)
+	}
+
+	material.CompiledShader = job.addCompileShaderTask(&CompileShaderTask{
+		Name:          material.Shader,
+		Preprocess:    true,
+		Defines:       defines,
+		BoundTextures: boundTextures,
+	})
+}
+
+func (job *compileJob) collectSceneTaskResults() {
+	reportedCompileTasks := map[int]bool{}
+	job.skipFailedParticleObjects(reportedCompileTasks)
+	job.skipFailedEffects(reportedCompileTasks)
+	job.scene.Textures = nil
+	job.scene.Shaders = nil
+	for _, anyTask := range job.tasks {
+		switch task := anyTask.(type) {
+		case *ImportTextureTask:
+			if task.Error != nil {
+				job.warnf("skipping texture %s: %s", task.Name, task.Error)
+				job.skipped.Textures++
+				continue
+			}
+			job.scene.Textures = append(job.scene.Textures, *task)
+		case *CompileShaderTask:
+			if task.Error != nil {
+				if reportedCompileTasks[task.ID] {
+					continue
+				}
+				job.warnf("skipping shader %s: %s", task.Name, task.Error)
+				job.skipped.Shaders++
+				continue
+			}
+			job.scene.Shaders = append(job.scene.Shaders, *task)
+			job.scene.AudioSpectrumSize = maxAudioSpectrumSize(
+				job.scene.AudioSpectrumSize, task.VertexUniforms, task.FragmentUniforms)
+		}
+	}
+}
+
+func maxAudioSpectrumSize(current int, uniformLists ...[]UniformInfo) int {
+	for _, uniforms := range uniformLists {
+		for _, uniform := range uniforms {
+			size := audioSpectrumUniformSize(uniform)
+			if size > current {
+				current = size
+			}
+		}
+	}
+	return current
+}
+
+func audioSpectrumUniformSize(uniform UniformInfo) int {
+	if uniform.Type != "float" || uniform.ArraySize <= 0 {
+		return 0
+	}
+
+	name, ok := strings.CutPrefix(uniform.Name, "g_AudioSpectrum")
+	if !ok {
+		return 0
+	}
+	name, left := strings.CutSuffix(name, "Left")
+	if !left {
+		var right bool
+		name, right = strings.CutSuffix(name, "Right")
+		if !right {
+			return 0
+		}
+	}
+
+	size, err := strconv.Atoi(name)
+	if err != nil || size <= 0 {
+		return 0
+	}
+	if uniform.ArraySize > size {
+		return uniform.ArraySize
+	}
+	return size
+}
+
+func (job *compileJob) skipFailedParticleObjects(reportedCompileTasks map[int]bool) {
+	for objectIndex, object := range job.scene.Objects {
+		if objectIndex >= len(job.scene.Types) || job.scene.Types[objectIndex] != 1 {
+			continue
+		}
+		particleObject, ok := object.(*ParticleObject)
+		if !ok {
+			continue
+		}
+
+		material := &particleObject.ParticleData.Material
+		if len(material.ImportedTextures) == 0 {
+			job.scene.Types[objectIndex] = 2
+			job.reportObject(object, ReportFailed, "texture was not imported")
+			job.skipped.Objects++
+			continue
+		}
+		textureTaskID := material.ImportedTextures[0]
+		if textureTaskID < 0 || textureTaskID >= len(job.tasks) {
+			job.scene.Types[objectIndex] = 2
+			job.reportObject(object, ReportFailed, "texture was not imported")
+			job.skipped.Objects++
+			continue
+		}
+		textureTask, textureOK := job.tasks[textureTaskID].(*ImportTextureTask)
+		if !textureOK || textureTask.Error != nil {
+			job.scene.Types[objectIndex] = 2
+			if textureOK {
+				job.dropObject(object, ReportFailed,
+					fmt.Sprintf("importing texture %s failed: %s", textureTask.Name, textureTask.Error))
+			} else {
+				job.reportObject(object, ReportFailed, "texture was not imported")
+				job.skipped.Objects++
+			}
+			continue
+		}
+
+		if material.CompiledShader < 0 || material.CompiledShader >= len(job.tasks) {
+			job.scene.Types[objectIndex] = 2
+			job.reportObject(object, ReportFailed, "particle shader was not compiled")
+			job.skipped.Objects++
+			continue
+		}
+		shaderTask, shaderOK := job.tasks[material.CompiledShader].(*CompileShaderTask)
+		if !shaderOK || shaderTask.Error != nil {
+			job.scene.Types[objectIndex] = 2
+			if shaderOK {
+				job.dropObject(object, ReportFailed, fmt.Sprintf("compile particle shader failed: %s", shaderTask.Error))
+				reportedCompileTasks[shaderTask.ID] = true
+				job.skipped.Shaders++
+			} else {
+				job.reportObject(object, ReportFailed, "particle shader was not compiled")
+				job.skipped.Objects++
+			}
+		}
+	}
+}
+
+func (job *compileJob) skipFailedEffects(reportedCompileTasks map[int]bool) {
+	for _, object := range job.scene.Objects {
+		imageObject, ok := object.(*ImageObject)
+		if !ok {
+			continue
+		}
+
+		filteredEffects := imageObject.Effects[:0]
+		for _, effect := range imageObject.Effects {
+			failedTasks := job.failedEffectShaderTasks(&effect)
+			if len(failedTasks) > 0 {
+				for _, failedTask := range failedTasks {
+					if !reportedCompileTasks[failedTask.ID] {
+						job.warnf("skipping effect %s shader %s: %s",
+							effectDisplayName(effect), failedTask.Name, failedTask.Error)
+						reportedCompileTasks[failedTask.ID] = true
+						job.skipped.Shaders++
+					}
+				}
+				job.reportEffect(&effect, ReportFailed, fmt.Sprintf("compiling shader %s failed", failedTasks[0].Name))
+				job.skipped.Effects++
+				continue
+			}
+			filteredEffects = append(filteredEffects, effect)
+		}
+		imageObject.Effects = filteredEffects
+	}
+}
+
+func (job *compileJob) failedEffectShaderTasks(effect *ImageEffect) []*CompileShaderTask {
+	failedTasks := []*CompileShaderTask{}
+	seenTaskIDs := map[int]bool{}
+	for materialIdx := range effect.Materials {
+		material := &effect.Materials[materialIdx]
+		if material.CompiledShader < 0 || material.CompiledShader >= len(job.tasks) {
+			continue
+		}
+		task, ok := job.tasks[material.CompiledShader].(*CompileShaderTask)
+		if ok && task.Error != nil && !seenTaskIDs[task.ID] {
+			failedTasks = append(failedTasks, task)
+			seenTaskIDs[task.ID] = true
+		}
+	}
+	return failedTasks
+}
+
+func (job *compileJob) addSamplerDefaultTextureTasks() {
+	for _, anyTask := range job.tasks {
+		task, ok := anyTask.(*CompileShaderTask)
+		if !ok || task.Error != nil {
+			continue
+		}
+		for _, sampler := range task.Samplers {
+			job.addImportTextureTask(&ImportTextureTask{Name: sampler.Default})
+		}
+	}
+}
+
+func getEffectBoundTextures(material *Material, pass *MaterialPass) []bool {
+	boundTextures := make([]bool, len(material.Textures))
+
+	for slot, textureName := range material.Textures {
+		if textureName != "" {
+			boundTextures[slot] = true
+		}
+	}
+	for slot, textureName := range pass.Textures {
+		boundTextures = ensureBoolSlots(boundTextures, slot+1)
+		if textureName != "" {
+			boundTextures[slot] = true
+		}
+	}
+	for _, binding := range pass.Bind {
+		if binding.Index < 0 {
+			continue
+		}
+		boundTextures = ensureBoolSlots(boundTextures, binding.Index+1)
+		if binding.Name != "" {
+			boundTextures[binding.Index] = true
+		}
+	}
+
+	return boundTextures
+}
+
+func ensureBoolSlots(slots []bool, slotCount int) []bool {
+	if len(slots) >= slotCount {
+		return slots
+	}
+	resized := make([]bool, slotCount)
+	copy(resized, slots)
+	return resized
+}
+
+func (job *compileJob) addImportTextureTask(task *ImportTextureTask) int {
+	if task.Name == "" {
+		return -1
+	}
+	if task.Name == "previous" || strings.HasPrefix(task.Name, "_rt_") || strings.HasPrefix(task.Name, "_alias_") {
+		return -1
+	}
+
+	for _, anyTask2 := range job.tasks {
+		task2, ok := anyTask2.(*ImportTextureTask)
+		if !ok {
+			continue
+		}
+		if task2.Name == task.Name {
+			return task2.ID
+		}
+	}
+
+	task.ID = len(job.tasks)
+	job.tasks = append(job.tasks, task)
+	return task.ID
+}
+
+func (job *compileJob) addCompileShaderTask(task *CompileShaderTask) int {
+	if task.Name == "" {
+		return -1
+	}
+
+	for _, anyTask2 := range job.tasks {
+		task2, ok := anyTask2.(*CompileShaderTask)
+		if !ok {
+			continue
+		}
+		if task2.Name == task.Name &&
+			task2.BuiltIn == task.BuiltIn &&
+			task2.Preprocess == task.Preprocess &&
+			maps.Equal(task2.Defines, task.Defines) &&
+			slices.Equal(task2.BoundTextures, task.BoundTextures) {
+			return task2.ID
+		}
+	}
+
+	task.ID = len(job.tasks)
+	job.tasks = append(job.tasks, task)
+	return task.ID
+}
+
+// executeTasksFrom runs tasks starting from startTaskIdx in parallel. Tasks that were not started
+// when the job is canceled are left as is, and the context error is returned.
+func (job *compileJob) executeTasksFrom(startTaskIdx int) error {
+	nextTaskIdx := startTaskIdx
+	finishedCount := 0
+	totalCount := len(job.tasks)
+	if startTaskIdx >= totalCount {
+		return job.ctx.Err()
+	}
+	descriptions := []string{}
+	startTimes := []int{}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	jobs := job.options.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	for threadIdx := range min(jobs, totalCount-startTaskIdx) {
+		wg.Add(1)
+		descriptions = append(descriptions, "")
+		startTimes = append(startTimes, 0)
+
+		go func() {
+			for {
+				mutex.Lock()
+				if nextTaskIdx >= totalCount || job.ctx.Err() != nil {
+					mutex.Unlock()
+					wg.Done()
+					return
+				}
+				taskIdx := nextTaskIdx
+				nextTaskIdx++
+				startTimes[threadIdx] = taskIdx
+				anyTask := job.tasks[taskIdx]
+
+				event := TaskEvent{Event: TaskStarted, Task: taskIdx, Total: len(job.tasks), Done: startTaskIdx + finishedCount}
+				var taskErr error
+				taskCached := false
+				if task, ok := anyTask.(*ImportTextureTask); ok {
+					descriptions[threadIdx] = fmt.Sprintf("importing texture %s", task.Name)
+					event.Kind, event.Name = "texture", task.Name
+					job.taskEvent(event)
+					mutex.Unlock()
+
+					job.importTexture(task)
+
+					mutex.Lock()
+					taskErr, taskCached = task.Error, task.Cached
+				} else if task, ok := anyTask.(*CompileShaderTask); ok {
+					descriptions[threadIdx] = fmt.Sprintf("compiling shader %s", task.Name)
+					event.Kind, event.Name = "shader", task.Name
+					job.taskEvent(event)
+					mutex.Unlock()
+
+					job.compileShader(task)
+
+					mutex.Lock()
+					taskErr, taskCached = task.Error, task.Cached
+				}
+
+				descriptions[threadIdx] = ""
+				finishedCount++
+				event.Event = TaskFinished
+				event.Done = startTaskIdx + finishedCount
+				if taskErr != nil {
+					event.Error = taskErr.Error()
+				}
+				event.Cached = taskCached
+				job.taskEvent(event)
+				lastTask := 0
+				for idx := range descriptions {
+					if descriptions[idx] != "" && (descriptions[lastTask] == "" || startTimes[lastTask] < startTimes[idx]) {
+						lastTask = idx
+					}
+				}
+				desc := descriptions[lastTask]
+				if desc == "" {
+					desc = "post-processing"
+				}
+				job.progress(startTaskIdx+finishedCount, len(job.tasks), desc)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return job.ctx.Err()
+}
+
+func (job *compileJob) importTexture(task *ImportTextureTask) {
+	texturePath := "materials/" + task.Name + ".tex"
+	textureBytes, err := job.getAssetBytes(texturePath)
+	if err != nil {
+		task.Error = err
+		return
+	}
+
+	metadataPath := "materials/" + task.Name + ".tex-json"
+	metadataBytes, _ := job.getAssetBytes(metadataPath)
+
+	cacheKey := job.cache.key("texture", textureBytes, metadataBytes)
+	converted := WebpResult{}
+	if job.cache.load("texture", cacheKey, &converted) {
+		task.Cached = true
+	} else {
+		converted, err = TexToWebp(textureBytes, metadataBytes)
+		if err != nil {
+			task.Error = err
+			return
+		}
+		if err := job.cache.store("texture", cacheKey, converted); err != nil {
+			job.warnf("caching texture %s failed: %s", task.Name, err)
+		}
+	}
+
+	task.Width = converted.Width
+	task.Height = converted.Height
+	task.Format = converted.Format
+	task.ClampUV = converted.ClampUV
+	task.Interpolation = converted.Interpolation
+	task.SpritesheetCols = converted.SpritesheetCols
+	task.SpritesheetRows = converted.SpritesheetRows
+	task.SpritesheetFrames = converted.SpritesheetFrames
+	task.SpritesheetDuration = converted.SpritesheetDuration
+
+	job.addOutput(fmt.Sprintf("textures/%d.webp", task.ID), converted.Data)
+}
+
+func (job *compileJob) compileShader(task *CompileShaderTask) {
+	vertexShaderPath := "shaders/" + task.Name + ".vert"
+	fragmentShaderPath := "shaders/" + task.Name + ".frag"
+
+	var vertexShaderBytes []byte
+	var fragmentShaderBytes []byte
+	var err error
+
+	switch task.BuiltIn {
+	case "":
+		vertexShaderBytes, err = job.getAssetBytes(vertexShaderPath)
+		if err != nil {
+			task.Error = err
+			return
+		}
+		fragmentShaderBytes, err = job.getAssetBytes(fragmentShaderPath)
+		if err != nil {
+			task.Error = err
+			return
+		}
+	case "particle":
+		vertexShaderBytes = particleVertexGLSL
+		fragmentShaderBytes = particleFragmentGLSL
+	default:
+		task.Error = fmt.Errorf("unknown built-in shader %s", task.BuiltIn)
+		return
+	}
+
+	// The key only depends on the sources, so a cached shader skips the preprocessor too. The glslc version is kept
+	// in the entry, so that a new glslc compiles the shader again. Without glslc any cached shader is used.
+	glslcVersion, glslcErr := job.glslc()
+	includes := job.shaderIncludes(string(vertexShaderBytes), string(fragmentShaderBytes))
+	cacheKey := job.cache.key("shader", vertexShaderBytes, fragmentShaderBytes,
+		shaderIncludesKey(includes), []byte(strconv.FormatBool(task.Preprocess)),
+		[]byte(strings.Join(defineArgs(task.Defines), " ")), []byte(fmt.Sprint(task.BoundTextures)))
+	compiled := cachedShader{}
+	if job.cache.load("shader", cacheKey, &compiled) && (glslcErr != nil || compiled.GLSLCVersion == glslcVersion) {
+		task.Cached = true
+	} else {
+		if glslcErr != nil {
+			task.Error = fmt.Errorf("glslc is not usable: %w", glslcErr)
+			return
+		}
+		compiled, err = job.buildShader(task, vertexShaderBytes, fragmentShaderBytes, includes)
+		if err != nil {
+			task.Error = err
+			return
+		}
+		compiled.GLSLCVersion = glslcVersion
+		if err := job.cache.store("shader", cacheKey, compiled); err != nil {
+			job.warnf("caching shader %s failed: %s", task.Name, err)
+		}
+	}
+	transformed := compiled.Shader
+	for _, warning := range transformed.Warnings {
+		job.warnf("shader %s: %s", task.Name, warning)
+	}
+
+	if job.options.KeepSources {
+		job.addOutput(fmt.Sprintf("shaders/%d_vertex.glsl", task.ID), []byte(transformed.VertexGLSL))
+		job.addOutput(fmt.Sprintf("shaders/%d_fragment.glsl", task.ID), []byte(transformed.FragmentGLSL))
+	}
+
+	job.addOutput(fmt.Sprintf("shaders/%d_vertex.spv", task.ID), compiled.VertexSPIRV)
+	job.addOutput(fmt.Sprintf("shaders/%d_fragment.spv", task.ID), compiled.FragmentSPIRV)
+
+	task.VertexUniforms = transformed.VertexUniforms
+	task.FragmentUniforms = transformed.FragmentUniforms
+	task.Attributes = transformed.Attributes
+	task.Samplers = transformed.Samplers
+}
+
+// buildShader preprocesses the shader sources if the task asks for it and compiles them to SPIR-V with glslc. The
+// preprocessor resolves includes from a temporary directory holding includes, see shaderIncludes.
+func (job *compileJob) buildShader(task *CompileShaderTask, vertexShaderBytes []byte, fragmentShaderBytes []byte,
+	includes map[string][]byte) (cachedShader, error) {
+	transformed := PreprocessedShader{
+		VertexGLSL:   string(vertexShaderBytes),
+		FragmentGLSL: string(fragmentShaderBytes),
+	}
+	ctx, cancel := job.taskContext()
+	defer cancel()
+	var err error
+	if task.Preprocess {
+		includeDir, err := os.MkdirTemp("", "wpe-compile-")
+		if err != nil {
+			return cachedShader{}, fmt.Errorf("creating temp dir failed: %w", err)
+		}
+		defer os.RemoveAll(includeDir)
+		if err := writeShaderIncludes(includeDir, includes); err != nil {
+			return cachedShader{}, fmt.Errorf("writing shader includes failed: %w", err)
+		}
+		transformed, err = PreprocessShader(ctx, string(vertexShaderBytes), string(fragmentShaderBytes),
+			includeDir, task.BoundTextures, task.Defines)
+		if err != nil {
+			return cachedShader{}, err
+		}
+	}
+
+	compiled := cachedShader{Shader: transformed}
+	glslcArgs := append([]string{"-fshader-stage=vertex"}, defineArgs(task.Defines)...)
+	compiled.VertexSPIRV, err = job.compileRawShader(ctx, []byte(transformed.VertexGLSL), glslcArgs)
+	if err != nil {
+		return cachedShader{}, fmt.Errorf("compile vertex shader failed: %w", err)
+	}
+
+	glslcArgs = append([]string{"-fshader-stage=fragment"}, defineArgs(task.Defines)...)
+	compiled.FragmentSPIRV, err = job.compileRawShader(ctx, []byte(transformed.FragmentGLSL), glslcArgs)
+	if err != nil {
+		return cachedShader{}, fmt.Errorf("compile fragment shader failed: %w", err)
+	}
+	return compiled, nil
+}
+
+// glslc returns what glslc --version prints, it is only run once per job.
+func (job *compileJob) glslc() (string, error) {
+	job.glslcOnce.Do(func() {
+		ctx, cancel := job.taskContext()
+		defer cancel()
+		version, err := runTool(ctx, "glslc", "--version")
+		job.glslcVersion, job.glslcErr = string(version), err
+	})
+	return job.glslcVersion, job.glslcErr
+}
+
+// glslcFailure returns the error of the first shader that had to be compiled while glslc is not usable.
+func (job *compileJob) glslcFailure() error {
+	if job.glslcErr == nil {
+		return nil
+	}
+	for _, task := range job.tasks {
+		if shaderTask, ok := task.(*CompileShaderTask); ok && errors.Is(shaderTask.Error, job.glslcErr) {
+			return shaderTask.Error
+		}
+	}
+	return nil
+}
+
+func (job *compileJob) compileRawShader(ctx context.Context, source []byte, glslcArgs []string) ([]byte, error) {
+	tempDir, err := os.MkdirTemp("", "wpe-compile-")
+	if err != nil {
+		return []byte{}, fmt.Errorf("creating temp dir failed: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			job.warnf("failed to remove temp dir: %s", err)
+		}
+	}()
+
+	err = os.WriteFile(tempDir+"/shader.glsl", source, 0644)
+	if err != nil {
+		return []byte{}, fmt.Errorf("write shader.glsl failed: %s", err)
+	}
+
+	glslcArgs = append(glslcArgs, tempDir+"/shader.glsl", "-o", tempDir+"/shader.spv")
+	logBytes, err := runTool(ctx, "glslc", glslcArgs...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return []byte{}, &GLSLCError{Log: glslcLog(logBytes, err)}
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+
+	SPIRVBytes, err := os.ReadFile(tempDir + "/shader.spv")
+	if err != nil {
+		return []byte{}, fmt.Errorf("read shader.spv failed: %s", err)
+	}
+	return SPIRVBytes, nil
+}
+
+// taskContext limits a single task to the task timeout of the job.
+func (job *compileJob) taskContext() (context.Context, context.CancelFunc) {
+	timeout := job.options.TaskTimeout
+	if timeout <= 0 {
+		timeout = DefaultTaskTimeout
+	}
+	return context.WithTimeoutCause(job.ctx, timeout, fmt.Errorf("timed out after %s", timeout))
+}
+
+// runTool runs a toolchain command and returns its combined output. The command is killed when ctx is done,
+// in that case the cause of ctx is returned instead of the exit error.
+func runTool(ctx context.Context, name string, args ...string) ([]byte, error) {
+	command := exec.CommandContext(ctx, name, args...)
+	command.WaitDelay = time.Second
+	output, err := command.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return output, fmt.Errorf("%s: %w", filepath.Base(name), context.Cause(ctx))
+	}
+	return output, err
+}
+
+func (job *compileJob) getAssetBytes(path string) ([]byte, error) {
+	asset, err := job.assets.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open asset %s failed: %s", path, err)
+	}
+	return asset, nil
+}
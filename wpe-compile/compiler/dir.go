@@ -0,0 +1,64 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// dirLayer serves files from a directory on disk, either an unpacked project or an asset root.
+type dirLayer struct {
+	label string
+	root  string
+}
+
+func (layer *dirLayer) name() string {
+	return layer.label
+}
+
+func (layer *dirLayer) readFile(path string) ([]byte, error) {
+	fullPath, ok := layer.fullPath(path)
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	// A directory or another non-regular file at the path does not hide the file in lower layers, like in hasFile.
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, syscall.ENOTDIR) || (err == nil && !info.Mode().IsRegular()) {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(fullPath)
+}
+
+func (layer *dirLayer) hasFile(path string) bool {
+	fullPath, ok := layer.fullPath(path)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(fullPath)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func (layer *dirLayer) fullPath(path string) (string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	if !fs.ValidPath(path) {
+		return "", false
+	}
+	return filepath.Join(layer.root, filepath.FromSlash(path)), true
+}
+
+// openProjectDir opens an unpacked project directory as the top asset layer. Without a scene.pkg next to it, the
+// directory has to contain the scene itself.
+func openProjectDir(dir string, hasPkg bool) (*dirLayer, error) {
+	project := &dirLayer{label: "project dir " + dir, root: dir}
+	if !hasPkg && !project.hasFile("scene.json") {
+		return nil, fmt.Errorf("%s has neither scene.json nor scene.pkg", dir)
+	}
+	return project, nil
+}
@@ -0,0 +1,102 @@
+package compiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAssetFSSkipsNonRegularFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	assetRoot := t.TempDir()
+	files := map[string]string{
+		filepath.Join(projectDir, "scene.json"):               `{"objects":[]}`,
+		filepath.Join(projectDir, "notdir"):                   "file",
+		filepath.Join(assetRoot, "materials", "a.json"):       "asset root a",
+		filepath.Join(assetRoot, "notdir", "b.json"):          "asset root b",
+		filepath.Join(assetRoot, "shaders", "effect.frag"):    "asset root shader",
+		filepath.Join(projectDir, "shaders", "effect.frag"):   "project shader",
+		filepath.Join(projectDir, "materials", "a.json", "x"): "directory in the way",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assets, err := OpenAssets(projectDir, []string{assetRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+	for path, expected := range map[string]string{
+		"materials/a.json":    "asset root a",
+		"notdir/b.json":       "asset root b",
+		"shaders/effect.frag": "project shader",
+	} {
+		data, err := assets.ReadFile(path)
+		if err != nil {
+			t.Errorf("read %s: %v", path, err)
+		} else if string(data) != expected {
+			t.Errorf("%s = %q, want %q", path, data, expected)
+		}
+	}
+}
+
+func TestOpenAssetsPkgSiblingDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		overlay bool
+	}{
+		{"no project", "", false},
+		{"project of the pkg", `{"type": "scene", "file": "scene.json"}`, true},
+		{"project naming the pkg", `{"type": "scene", "file": "wallpaper.pkg"}`, true},
+		{"project of another file", `{"type": "video", "file": "video.mp4"}`, false},
+		{"project without a file", `{"type": "scene"}`, false},
+		{"broken project", `{`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			pkgPath := filepath.Join(dir, "wallpaper.pkg")
+			pkgData := &bytes.Buffer{}
+			writeStringI32(pkgData, "PKGV0001")
+			writeInt32(pkgData, 1)
+			writeStringI32(pkgData, "scene.json")
+			writeInt32(pkgData, 0)
+			writeInt32(pkgData, 3)
+			pkgData.WriteString("pkg")
+			files := map[string]string{pkgPath: pkgData.String(), filepath.Join(dir, "scene.json"): "dir"}
+			if test.project != "" {
+				files[filepath.Join(dir, "project.json")] = test.project
+			}
+			for path, content := range files {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assets, err := OpenAssets(pkgPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer assets.Close()
+			expectedLayers, expected := []string{"wallpaper.pkg"}, "pkg"
+			if test.overlay {
+				expectedLayers, expected = []string{"project dir " + dir, "wallpaper.pkg"}, "dir"
+			}
+			if layers := assets.Layers(); !slices.Equal(layers, expectedLayers) {
+				t.Errorf("layers = %q, want %q", layers, expectedLayers)
+			}
+			if data, err := assets.ReadFile("scene.json"); err != nil || string(data) != expected {
+				t.Errorf("scene.json = %q, %v, want %q", data, err, expected)
+			}
+		})
+	}
+}
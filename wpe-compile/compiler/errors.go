@@ -0,0 +1,73 @@
+package compiler
+
+import (
+	"errors"
+	"runtime/debug"
+)
+
+// ErrorKind tells which stage of the conversion failed.
+type ErrorKind int
+
+const (
+	// InputError means the input, project or options are unreadable or invalid.
+	InputError ErrorKind = iota + 1
+	// ToolchainError means glslc is missing while a shader has to be compiled, or the WASM C compiler is missing.
+	ToolchainError
+	// ParseError means scene.json or one of the files it refers to could not be parsed.
+	ParseError
+	// CompileError means the scene module could not be generated or compiled.
+	CompileError
+	// OutputError means the owf archive could not be written.
+	OutputError
+	// CanceledError means the context of the Compile call was canceled.
+	CanceledError
+)
+
+func (kind ErrorKind) String() string {
+	switch kind {
+	case InputError:
+		return "input error"
+	case ToolchainError:
+		return "toolchain error"
+	case ParseError:
+		return "parse error"
+	case CompileError:
+		return "compile error"
+	case OutputError:
+		return "output error"
+	case CanceledError:
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+// Error is returned by Compile for every failure. Log holds compiler output if there is any,
+// Stack is where the error was created, both are meant for debugging.
+type Error struct {
+	Kind  ErrorKind
+	Err   error
+	Log   string
+	Stack []byte
+}
+
+func NewError(kind ErrorKind, err error) *Error {
+	return &Error{Kind: kind, Err: err, Stack: debug.Stack()}
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// KindOf returns the kind of the first Error in the chain, or 0 if there is none.
+func KindOf(err error) ErrorKind {
+	var compileErr *Error
+	if errors.As(err, &compileErr) {
+		return compileErr.Kind
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+//go:build ignore
+
+// gen_owapi.go writes owapi.go, the wasm32 signatures of the ow_* functions declared in openwallpaper.h and the
+// header itself, which the scene module is compiled against. The header is a symlink out of the Go module, so it
+// cannot be embedded and is copied here instead. Run it with go generate after changing the header.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var functionPattern = regexp.MustCompile(`extern\s+([^;(]+?)\s*\b(ow_\w+)\s*\(([^)]*)\)\s*;`)
+var commentPattern = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+
+// wasmType returns the wasm32 value type a C parameter or return type is lowered to. Handles like ow_texture_id
+// are structs with a single uint32_t, which clang passes and returns as i32 like pointers and integers.
+func wasmType(declaration string) string {
+	if strings.Contains(declaration, "*") {
+		return "wasmTypeI32"
+	}
+	switch strings.Fields(declaration)[0] {
+	case "float":
+		return "wasmTypeF32"
+	case "double":
+		return "wasmTypeF64"
+	case "int64_t", "uint64_t":
+		return "wasmTypeI64"
+	default:
+		return "wasmTypeI32"
+	}
+}
+
+// headerLiteral returns the header as raw string literals joined around its backquotes, so that it stays readable
+// in owapi.go.
+func headerLiteral(header string) string {
+	if strings.Contains(header, "\r") {
+		return strconv.Quote(header)
+	}
+	return "`" + strings.ReplaceAll(header, "`", "` + \"`\" + `") + "`"
+}
+
+func main() {
+	header, err := os.ReadFile("module/openwallpaper.h")
+	if err != nil {
+		log.Fatal(err)
+	}
+	functions := map[string]string{}
+	for _, match := range functionPattern.FindAllSubmatch(commentPattern.ReplaceAll(header, nil), -1) {
+		results := []string{}
+		if returnType := strings.TrimSpace(string(match[1])); returnType != "void" {
+			results = append(results, wasmType(returnType))
+		}
+		params := []string{}
+		if paramList := strings.TrimSpace(string(match[3])); paramList != "" && paramList != "void" {
+			for _, param := range strings.Split(paramList, ",") {
+				params = append(params, wasmType(param))
+			}
+		}
+		functions[string(match[2])] = fmt.Sprintf("{Params: []byte{%s}, Results: []byte{%s}}",
+			strings.Join(params, ", "), strings.Join(results, ", "))
+	}
+	if len(functions) == 0 {
+		log.Fatal("no ow_* functions found in openwallpaper.h")
+	}
+
+	output := &bytes.Buffer{}
+	fmt.Fprintln(output, "// Code generated by gen_owapi.go from openwallpaper.h; DO NOT EDIT.")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "package compiler")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "var owFunctionTypes = map[string]wasmFuncType{")
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(output, "%q: %s,\n", name, functions[name])
+	}
+	fmt.Fprintln(output, "}")
+	fmt.Fprintln(output)
+	fmt.Fprintf(output, "const openwallpaperHeader = %s\n", headerLiteral(string(header)))
+
+	source, err := format.Source(output.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("owapi.go", source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
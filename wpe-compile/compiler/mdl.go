@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"encoding/binary"
@@ -110,7 +110,7 @@ func (reader *mdlReader) peekMagic(magic string) bool {
 	return len(magic) == 4 && reader.off+4 <= len(reader.data) && string(reader.data[reader.off:reader.off+4]) == magic
 }
 
-func parsePuppetMetadata(path string, data []byte) (*PuppetMetadata, error) {
+func ParsePuppetMetadata(path string, data []byte) (*PuppetMetadata, error) {
 	reader := mdlReader{data: data}
 	version, _, err := reader.readVersion("MDL")
 	if err != nil {
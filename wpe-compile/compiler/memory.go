@@ -0,0 +1,129 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+)
+
+const wasmPageSize = 64 * 1024
+
+// maxWasmPages is the most a wasm32 memory can grow to, limitModuleMemory caps scenes there.
+const maxWasmPages = 65536
+
+// wallpaperdMemoryBudget is the memory a scene can use in wallpaperd without trouble. wallpaperd runs a scene
+// instance per output and WAMR takes the memory of each from the system heap as it grows, so a scene above this is
+// likely to fail or starve the desktop on multi-monitor setups long before wasm32 runs out of addresses.
+const wallpaperdMemoryBudget = 1024 * 1024 * 1024
+
+// transformStackFrame is the stack object_global_transform in transform.c takes per parent, with a safe margin for
+// the matrices it keeps on the stack.
+const transformStackFrame = 1024
+
+// Sizes of what the scene module allocates at runtime, see defs.h. They are estimates on the safe side, malloc
+// overhead and fragmentation are covered by moduleMemoryMargin.
+const (
+	// particleInstanceMemory is a wpe_particle_instance and a wpe_particle_instance_data. Both are allocated for
+	// MaxCount particles per system, emitters share them.
+	particleInstanceMemory = 108 + 48
+	// puppetMemoryFactor covers the mdl file, which is read whole, and the meshes, bones and animations parsed from
+	// it, which take about as much as the file.
+	puppetMemoryFactor = 2
+	// effectPassMemory is the uniform data, texture bindings and slots of a pass.
+	effectPassMemory = 16 * 1024
+	// effectFBOMemory is the bookkeeping of an FBO, the texture itself lives in wallpaperd.
+	effectFBOMemory = 1024
+	// sceneDataMemoryFactor covers scene.bin, which is kept loaded because strings point into it, and the objects,
+	// materials and shaders read from it.
+	sceneDataMemoryFactor = 4
+	// moduleBaseMemory is what the module needs for any scene: libc, the renderer state and temporary buffers.
+	moduleBaseMemory   = 16 * 1024 * 1024
+	moduleMemoryMargin = 2
+)
+
+// estimateSceneMemory returns how much heap the scene module needs for the scene in bytes.
+func estimateSceneMemory(scene Scene, sceneDataSize int) uint64 {
+	memory := uint64(moduleBaseMemory)
+	memory += uint64(sceneDataSize) * sceneDataMemoryFactor
+	memory += uint64(scene.AudioSpectrumSize) * 4
+
+	for objectIndex, object := range scene.Objects {
+		objectType := 2
+		if objectIndex < len(scene.Types) {
+			objectType = scene.Types[objectIndex]
+		}
+		switch object := object.(type) {
+		case *ImageObject:
+			if objectType != 0 {
+				continue
+			}
+			memory += uint64(len(object.PuppetData)) * puppetMemoryFactor
+			for _, effect := range object.Effects {
+				memory += uint64(len(effect.Passes)) * effectPassMemory
+				memory += uint64(len(effect.FBOs)) * effectFBOMemory
+			}
+		case *ParticleObject:
+			if objectType != 1 {
+				continue
+			}
+			memory += uint64(object.ParticleData.MaxCount) * particleInstanceMemory
+		}
+	}
+	return memory * moduleMemoryMargin
+}
+
+// limitModuleMemory returns the scene module with the maximum of its memory set to its initial memory, which
+// holds the data and the stack, plus the heap the scene is estimated to need, capped at what wasm32 can address.
+// Only the limits in the memory section change, every other section of the module is the same byte for byte in every
+// scene, see TestLimitModuleMemoryKeepsCode. It warns if the scene likely needs more than wallpaperdMemoryBudget.
+func (job *compileJob) limitModuleMemory(moduleBytes []byte, sceneDataSize int) ([]byte, error) {
+	module, err := parseWasmModule(moduleBytes)
+	if err != nil || len(module.Memories) == 0 {
+		return nil, NewError(CompileError, errors.New("scene module does not define its memory"))
+	}
+
+	initialPages := min(module.Memories[0].Min, maxWasmPages)
+	required := initialPages*wasmPageSize + estimateSceneMemory(job.scene, sceneDataSize)
+	if required > wallpaperdMemoryBudget {
+		job.warnf("scene likely needs %d MiB of memory, more than the %d MiB wallpaperd can provide",
+			(required+1<<20-1)>>20, wallpaperdMemoryBudget>>20)
+	}
+	pages := min((required+wasmPageSize-1)/wasmPageSize, maxWasmPages)
+
+	moduleBytes, err = setWasmMemoryLimits(moduleBytes, initialPages, pages)
+	if err != nil {
+		return nil, NewError(CompileError, fmt.Errorf("setting scene module memory limit failed: %w", err))
+	}
+	return moduleBytes, nil
+}
+
+// checkModuleStack warns if the object hierarchy of the scene is so deep that computing its transforms likely
+// overflows the stack of the scene module.
+func (job *compileJob) checkModuleStack() {
+	depth := objectHierarchyDepth(job.scene)
+	if depth*transformStackFrame > moduleStackSize {
+		job.warnf("objects are nested %d levels deep, the scene module stack likely overflows", depth)
+	}
+}
+
+// objectHierarchyDepth returns the length of the longest parent chain in the scene, parent cycles end a chain.
+func objectHierarchyDepth(scene Scene) int {
+	parents := map[int]int{}
+	for objectIndex, object := range scene.Objects {
+		info := sceneObjectInfo(objectIndex, object)
+		parents[info.ID] = info.Parent
+	}
+	maxDepth := 0
+	for id := range parents {
+		depth := 1
+		visited := map[int]bool{id: true}
+		for parent, ok := parents[id]; ok && parent >= 0 && !visited[parent]; parent, ok = parents[parent] {
+			if _, exists := parents[parent]; !exists {
+				break
+			}
+			visited[parent] = true
+			depth++
+		}
+		maxDepth = max(maxDepth, depth)
+	}
+	return maxDepth
+}
@@ -0,0 +1,215 @@
+package compiler
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEstimateSceneMemory(t *testing.T) {
+	puppet := &ImageObject{PuppetData: make([]byte, 1000)}
+	effects := &ImageObject{Effects: []ImageEffect{
+		{Passes: make([]MaterialPass, 2), FBOs: make([]EffectFBO, 1)},
+		{Passes: make([]MaterialPass, 1)},
+	}}
+	particles := &ParticleObject{ParticleData: Particle{MaxCount: 500}}
+
+	tests := []struct {
+		name          string
+		scene         Scene
+		sceneDataSize int
+		expected      uint64
+	}{
+		{"empty scene", Scene{}, 0, moduleBaseMemory * moduleMemoryMargin},
+		{"scene data", Scene{}, 100, (moduleBaseMemory + 100*sceneDataMemoryFactor) * moduleMemoryMargin},
+		{"audio spectrum", Scene{AudioSpectrumSize: 64}, 0, (moduleBaseMemory + 64*4) * moduleMemoryMargin},
+		{"puppet", Scene{Objects: []SceneObject{puppet}, Types: []int{0}}, 0,
+			(moduleBaseMemory + 1000*puppetMemoryFactor) * moduleMemoryMargin},
+		{"effects", Scene{Objects: []SceneObject{effects}, Types: []int{0}}, 0,
+			(moduleBaseMemory + 3*effectPassMemory + effectFBOMemory) * moduleMemoryMargin},
+		{"particles", Scene{Objects: []SceneObject{particles}, Types: []int{1}}, 0,
+			(moduleBaseMemory + 500*particleInstanceMemory) * moduleMemoryMargin},
+		{"skipped objects", Scene{Objects: []SceneObject{puppet, particles}, Types: []int{2, 2}}, 0,
+			moduleBaseMemory * moduleMemoryMargin},
+		{"objects without a type", Scene{Objects: []SceneObject{puppet, particles}}, 0,
+			moduleBaseMemory * moduleMemoryMargin},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if memory := estimateSceneMemory(test.scene, test.sceneDataSize); memory != test.expected {
+				t.Errorf("memory = %d, want %d", memory, test.expected)
+			}
+		})
+	}
+}
+
+func TestLimitModuleMemory(t *testing.T) {
+	particles := func(count uint32) Scene {
+		return Scene{Objects: []SceneObject{&ParticleObject{ParticleData: Particle{MaxCount: count}}}, Types: []int{1}}
+	}
+	pagesFor := func(scene Scene, initial uint64) uint64 {
+		return (initial*wasmPageSize + estimateSceneMemory(scene, 0) + wasmPageSize - 1) / wasmPageSize
+	}
+
+	tests := []struct {
+		name     string
+		scene    Scene
+		memory   *wasmLimits
+		expected wasmLimits
+		warning  string
+	}{
+		{"small scene", Scene{}, &wasmLimits{Min: 16, Max: 4096, HasMax: true},
+			wasmLimits{Min: 16, Max: pagesFor(Scene{}, 16), HasMax: true}, ""},
+		{"large scene", particles(1 << 20), &wasmLimits{Min: 16, Max: 4096, HasMax: true},
+			wasmLimits{Min: 16, Max: pagesFor(particles(1<<20), 16), HasMax: true}, ""},
+		{"no maximum", Scene{}, &wasmLimits{Min: 2},
+			wasmLimits{Min: 2, Max: pagesFor(Scene{}, 2), HasMax: true}, ""},
+		{"over budget", particles(1 << 22), &wasmLimits{Min: 16},
+			wasmLimits{Min: 16, Max: pagesFor(particles(1<<22), 16), HasMax: true}, "more than the 1024 MiB wallpaperd"},
+		{"over wasm32", particles(1 << 25), &wasmLimits{Min: 16},
+			wasmLimits{Min: 16, Max: maxWasmPages, HasMax: true}, "more than the 1024 MiB wallpaperd"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := validTestWasm()
+			module.memory = test.memory
+			job := &compileJob{scene: test.scene}
+			moduleBytes, err := job.limitModuleMemory(module.bytes(), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			parsed, err := parseWasmModule(moduleBytes)
+			if err != nil {
+				t.Fatalf("patched module does not parse: %v", err)
+			}
+			if len(parsed.Memories) != 1 || parsed.Memories[0] != test.expected {
+				t.Errorf("memories = %v, want [%v]", parsed.Memories, test.expected)
+			}
+			if err := validateModule(moduleBytes); err != nil {
+				t.Errorf("patched module is not valid: %v", err)
+			}
+			if test.warning == "" {
+				if len(job.warnings) != 0 {
+					t.Errorf("unexpected warnings %v", job.warnings)
+				}
+				return
+			}
+			if len(job.warnings) != 1 || !strings.Contains(job.warnings[0], test.warning) {
+				t.Errorf("warnings = %v, want one containing %q", job.warnings, test.warning)
+			}
+		})
+	}
+}
+
+func TestLimitModuleMemoryKeepsCode(t *testing.T) {
+	module := validTestWasm()
+	original := module.bytes()
+	small, err := (&compileJob{scene: Scene{}}).limitModuleMemory(original, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := (&compileJob{scene: Scene{}}).limitModuleMemory(original, 1<<24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(small, large) {
+		t.Fatal("modules for different scenes have the same memory limit")
+	}
+	withoutMemory := func(data []byte) []byte {
+		result := slices.Clip(data[:8])
+		reader := &wasmReader{data: data, off: 8}
+		for reader.off < len(reader.data) {
+			start := reader.off
+			sectionID, _ := reader.readByte()
+			size, _ := reader.readLEB()
+			reader.readBytes(size)
+			if sectionID != wasmSectionMemory {
+				result = append(result, data[start:reader.off]...)
+			}
+		}
+		return result
+	}
+	if !bytes.Equal(withoutMemory(small), withoutMemory(original)) || !bytes.Equal(withoutMemory(large), withoutMemory(original)) {
+		t.Error("sections other than memory changed")
+	}
+}
+
+func TestLimitModuleMemoryKeepsFlags(t *testing.T) {
+	memoryFlags := func(data []byte) byte {
+		reader := &wasmReader{data: data, off: 8}
+		for reader.off < len(reader.data) {
+			sectionID, _ := reader.readByte()
+			size, _ := reader.readLEB()
+			content, _ := reader.readBytes(size)
+			if sectionID == wasmSectionMemory {
+				return content[1]
+			}
+		}
+		t.Fatal("module has no memory section")
+		return 0
+	}
+
+	module := validTestWasm()
+	module.memory = &wasmLimits{Min: 2}
+	original := module.bytes()
+	flagsOffset := bytes.Index(original, []byte{wasmSectionMemory, 3, 1, 0, 2}) + 3
+	original[flagsOffset] = 0x02 // shared without a maximum
+
+	moduleBytes, err := (&compileJob{scene: Scene{}}).limitModuleMemory(original, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := memoryFlags(moduleBytes); flags != 0x03 {
+		t.Errorf("memory flags = %#x, want 0x03", flags)
+	}
+}
+
+func TestObjectHierarchyDepth(t *testing.T) {
+	object := func(id, parent int) SceneObject { return &EmptyObject{ID: id, Parent: parent} }
+
+	tests := []struct {
+		name     string
+		objects  []SceneObject
+		expected int
+	}{
+		{"no objects", nil, 0},
+		{"flat", []SceneObject{object(1, -1), object(2, -1)}, 1},
+		{"chain", []SceneObject{object(3, 2), object(1, -1), object(2, 1)}, 3},
+		{"missing parent", []SceneObject{object(1, 7), object(2, 1)}, 2},
+		{"cycle", []SceneObject{object(1, 2), object(2, 1)}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if depth := objectHierarchyDepth(Scene{Objects: test.objects}); depth != test.expected {
+				t.Errorf("depth = %d, want %d", depth, test.expected)
+			}
+		})
+	}
+}
+
+func TestCheckModuleStack(t *testing.T) {
+	var objects []SceneObject
+	for id := range moduleStackSize/transformStackFrame + 1 {
+		objects = append(objects, &EmptyObject{ID: id, Parent: id - 1})
+	}
+	job := &compileJob{scene: Scene{Objects: objects}}
+	job.checkModuleStack()
+	if len(job.warnings) != 1 || !strings.Contains(job.warnings[0], "stack likely overflows") {
+		t.Errorf("warnings = %v, want a stack warning", job.warnings)
+	}
+
+	job = &compileJob{scene: Scene{Objects: objects[:10]}}
+	job.checkModuleStack()
+	if len(job.warnings) != 0 {
+		t.Errorf("unexpected warnings %v", job.warnings)
+	}
+}
+
+func TestLimitModuleMemoryWithoutMemory(t *testing.T) {
+	module := validTestWasm()
+	module.memory = nil
+	if _, err := (&compileJob{}).limitModuleMemory(module.bytes(), 0); err == nil {
+		t.Error("expected an error for a module without memory")
+	}
+}
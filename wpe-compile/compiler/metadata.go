@@ -0,0 +1,453 @@
+package compiler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+
+	"github.com/BurntSushi/toml"
+	"github.com/chai2010/webp"
+)
+
+const modulePath = "github.com/mechakotik/openwallpaper/wpe-compile"
+
+const (
+	previewMaxWidth  = 1920
+	previewMaxHeight = 1080
+	previewQuality   = 98
+)
+
+type Project struct {
+	Title         string          `json:"title"`
+	Description   string          `json:"description"`
+	Preview       string          `json:"preview"`
+	Type          string          `json:"type"`
+	File          string          `json:"file"`
+	Tags          []string        `json:"tags"`
+	ContentRating string          `json:"contentrating"`
+	WorkshopID    json.RawMessage `json:"workshopid"`
+	General       ProjectGeneral  `json:"general"`
+}
+
+type ProjectGeneral struct {
+	Properties map[string]ProjectProperty `json:"properties"`
+}
+
+type ProjectProperty struct {
+	Type    string                  `json:"type"`
+	Text    string                  `json:"text"`
+	Value   json.RawMessage         `json:"value"`
+	Order   IntValue                `json:"order"`
+	Min     *FloatValue             `json:"min"`
+	Max     *FloatValue             `json:"max"`
+	Step    *FloatValue             `json:"step"`
+	Options []ProjectPropertyOption `json:"options"`
+}
+
+type ProjectPropertyOption struct {
+	Label string          `json:"label"`
+	Value json.RawMessage `json:"value"`
+}
+
+var supportedPropertyTypes = map[string]bool{
+	"slider":    true,
+	"color":     true,
+	"bool":      true,
+	"combo":     true,
+	"textinput": true,
+}
+
+type Metadata struct {
+	Info    MetadataInfo              `toml:"info"`
+	Video   *MetadataVideo            `toml:"video,omitempty"`
+	Source  MetadataSource            `toml:"source"`
+	Options map[string]MetadataOption `toml:"options,omitempty"`
+}
+
+type MetadataInfo struct {
+	Name          string   `toml:"name"`
+	Description   string   `toml:"description"`
+	Preview       string   `toml:"preview,omitempty"`
+	Tags          []string `toml:"tags,omitempty"`
+	ContentRating string   `toml:"content_rating,omitempty"`
+}
+
+type MetadataVideo struct {
+	File string `toml:"file"`
+}
+
+type MetadataSource struct {
+	Type       string `toml:"type,omitempty"`
+	WorkshopID string `toml:"workshop_id,omitempty"`
+	File       string `toml:"file,omitempty"`
+	SHA256     string `toml:"sha256,omitempty"`
+	Compiler   string `toml:"compiler"`
+}
+
+type MetadataOption struct {
+	Type    string   `toml:"type"`
+	Label   string   `toml:"label"`
+	Order   int      `toml:"order"`
+	Default *string  `toml:"default,omitempty"`
+	Min     *float64 `toml:"min,omitempty"`
+	Max     *float64 `toml:"max,omitempty"`
+	Step    *float64 `toml:"step,omitempty"`
+	Values  []string `toml:"values,omitempty"`
+	Labels  []string `toml:"labels,omitempty"`
+}
+
+func loadProject(projectPath string) (Project, error) {
+	projectBytes, err := os.ReadFile(projectPath)
+	if err != nil {
+		return Project{}, fmt.Errorf("failed to load project JSON: %w", err)
+	}
+
+	project := Project{}
+	err = json.Unmarshal(projectBytes, &project)
+	if err != nil {
+		return Project{}, fmt.Errorf("failed to parse project JSON: %w", err)
+	}
+	return project, nil
+}
+
+func (job *compileJob) makeMetadata(projectPath string, inputPath string, overrides UserOverrides) {
+	project := Project{Title: defaultProjectTitle(inputPath), Type: "scene"}
+	projectDir := ""
+	if projectPath != "" {
+		loaded, err := loadProject(projectPath)
+		if err != nil {
+			job.warnf("%s", err)
+		} else {
+			project = loaded
+			projectDir = filepath.Dir(projectPath)
+		}
+	}
+	// The output is a scene even if project.json names another type that had a scene.json to fall back to, the
+	// type is kept as is in [source] to tell where the scene came from.
+	if len(overrides) > 0 {
+		sceneBytes, _ := job.assets.ReadFile("scene.json")
+		for _, name := range overrides.unusedNames(sceneBytes, project.General.Properties) {
+			job.warnf("user property %s is not used by the scene, its value is ignored", name)
+		}
+	}
+	for name := range overrides {
+		delete(project.General.Properties, name)
+	}
+
+	sourcePath := ""
+	projectFile := filepath.Join(projectDir, filepath.FromSlash(project.File))
+	if isRegularFile(inputPath) {
+		sourcePath = inputPath
+	} else if project.File != "" && isRegularFile(projectFile) {
+		sourcePath = projectFile
+	}
+	job.addMetadata(project, projectDir, sourcePath, "", job.composeScenePreview)
+}
+
+func defaultProjectTitle(inputPath string) string {
+	absPath, err := filepath.Abs(inputPath)
+	if err != nil {
+		absPath = inputPath
+	}
+	title := strings.TrimSuffix(filepath.Base(absPath), filepath.Ext(absPath))
+	if strings.EqualFold(title, "scene") {
+		title = filepath.Base(filepath.Dir(absPath))
+	}
+	return title
+}
+
+func (job *compileJob) addMetadata(project Project, projectDir string, sourcePath string, videoFile string,
+	fallbackPreview func() ([]byte, error)) {
+	metadata := Metadata{
+		Info: MetadataInfo{
+			Name:          project.Title,
+			Description:   project.Description,
+			Tags:          project.Tags,
+			ContentRating: project.ContentRating,
+		},
+		Source: MetadataSource{
+			Type:     project.Type,
+			File:     project.File,
+			Compiler: "wpe-compile " + compilerVersion(),
+		},
+		Options: makeMetadataOptions(project.General.Properties),
+	}
+	if bytesFromRawNullAware(project.WorkshopID) != nil {
+		metadata.Source.WorkshopID = rawOptionValue(project.WorkshopID)
+	}
+
+	previewWEBP, err := loadPreviewWEBP(projectDir, project.Preview)
+	if err != nil && fallbackPreview != nil {
+		if project.Preview != "" {
+			job.warnf("%s, generating preview from scene", err)
+		}
+		previewWEBP, err = fallbackPreview()
+	}
+	if err != nil {
+		job.warnf("%s", err)
+	} else {
+		job.addOutput("preview.webp", previewWEBP)
+		metadata.Info.Preview = "preview.webp"
+	}
+
+	if sourcePath != "" {
+		hash, err := hashFile(sourcePath)
+		if err != nil {
+			job.warnf("failed to hash source file: %s", err)
+		} else {
+			metadata.Source.SHA256 = hash
+		}
+	}
+
+	if videoFile != "" {
+		metadata.Video = &MetadataVideo{File: videoFile}
+	}
+
+	buffer := bytes.Buffer{}
+	encoder := toml.NewEncoder(&buffer)
+	encoder.Indent = ""
+	if err := encoder.Encode(metadata); err != nil {
+		job.warnf("failed to encode metadata: %s", err)
+		return
+	}
+	job.addOutput("metadata.toml", buffer.Bytes())
+}
+
+func makeMetadataOptions(properties map[string]ProjectProperty) map[string]MetadataOption {
+	options := map[string]MetadataOption{}
+	for name, property := range properties {
+		if !supportedPropertyTypes[property.Type] {
+			continue
+		}
+		option := MetadataOption{
+			Type:  property.Type,
+			Label: property.Text,
+			Order: int(property.Order),
+			Min:   metadataFloat(property.Min),
+			Max:   metadataFloat(property.Max),
+			Step:  metadataFloat(property.Step),
+		}
+		if bytesFromRawNullAware(property.Value) != nil {
+			value := rawOptionValue(property.Value)
+			option.Default = &value
+		}
+		for _, propertyOption := range property.Options {
+			option.Values = append(option.Values, rawOptionValue(propertyOption.Value))
+			option.Labels = append(option.Labels, propertyOption.Label)
+		}
+		options[name] = option
+	}
+	return options
+}
+
+func metadataFloat(value *FloatValue) *float64 {
+	if value == nil {
+		return nil
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(float64(*value), 'g', -1, 32), 64)
+	return &rounded
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func compilerVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath && dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+func loadPreviewWEBP(projectDir string, preview string) ([]byte, error) {
+	if preview == "" {
+		return nil, errors.New("project has no preview image")
+	}
+	previewBytes, err := os.ReadFile(filepath.Join(projectDir, preview))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load preview image: %w", err)
+	}
+
+	previewWEBP, err := makePreviewWEBP(previewBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make preview WEBP: %w", err)
+	}
+	return previewWEBP, nil
+}
+
+func makePreviewWEBP(imageBytes []byte) ([]byte, error) {
+	if len(imageBytes) == 0 {
+		return nil, errors.New("image bytes are empty")
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("decode preview image failed: %w", err)
+	}
+	switch format {
+	case "jpeg", "png":
+	case "gif":
+		animation, err := gif.DecodeAll(bytes.NewReader(imageBytes))
+		if err != nil {
+			return nil, fmt.Errorf("decode preview image failed: %w", err)
+		}
+		if len(animation.Image) > 1 {
+			return makeAnimatedPreviewWEBP(animation)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("decode preview image failed: %w", err)
+	}
+	preview, err := fitPreviewImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := webp.Encode(&buffer, preview, &webp.Options{Lossless: false, Quality: previewQuality}); err != nil {
+		return nil, fmt.Errorf("encode preview webp failed: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func makeAnimatedPreviewWEBP(animation *gif.GIF) ([]byte, error) {
+	canvasRect := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+	if canvasRect.Empty() {
+		canvasRect = animation.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(canvasRect)
+	previous := image.NewRGBA(canvasRect)
+
+	loopCount := 0
+	if animation.LoopCount < 0 {
+		loopCount = 1
+	} else if animation.LoopCount > 0 {
+		loopCount = animation.LoopCount + 1
+	}
+
+	encoder := newWEBPAnimationEncoder(&webp.Options{Lossless: false, Quality: previewQuality})
+	for index, frame := range animation.Image {
+		disposal := byte(gif.DisposalNone)
+		if index < len(animation.Disposal) {
+			disposal = animation.Disposal[index]
+		}
+		if disposal == gif.DisposalPrevious {
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		preview, err := fitPreviewImage(canvas)
+		if err != nil {
+			return nil, err
+		}
+		delay := 10
+		if index < len(animation.Delay) && animation.Delay[index] > 0 {
+			delay = animation.Delay[index]
+		}
+		if err := encoder.addFrame(preview, delay*10); err != nil {
+			return nil, fmt.Errorf("encode animated preview webp failed: %w", err)
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+
+	previewWEBP, err := encoder.finish(loopCount)
+	if err != nil {
+		return nil, fmt.Errorf("encode animated preview webp failed: %w", err)
+	}
+	return previewWEBP, nil
+}
+
+// fitPreviewImage crops img to 16:9 around its center and downscales it to fit the preview size limit.
+func fitPreviewImage(img image.Image) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	srcWidth := bounds.Dx()
+	srcHeight := bounds.Dy()
+	if srcWidth <= 0 || srcHeight <= 0 {
+		return nil, errors.New("invalid image dimensions")
+	}
+
+	cropWidth := srcWidth
+	cropHeight := srcHeight
+	if srcWidth*9 > srcHeight*16 {
+		cropWidth = srcHeight * 16 / 9
+	} else if srcWidth*9 < srcHeight*16 {
+		cropHeight = srcWidth * 9 / 16
+	}
+	if cropWidth <= 0 || cropHeight <= 0 {
+		return nil, errors.New("invalid crop size")
+	}
+
+	offsetX := (srcWidth - cropWidth) / 2
+	offsetY := (srcHeight - cropHeight) / 2
+	cropRect := image.Rect(0, 0, cropWidth, cropHeight)
+	cropped := image.NewRGBA(cropRect)
+	draw.Draw(cropped, cropRect, img, image.Point{X: bounds.Min.X + offsetX, Y: bounds.Min.Y + offsetY}, draw.Src)
+
+	outWidth := cropWidth
+	outHeight := cropHeight
+	if outWidth > previewMaxWidth || outHeight > previewMaxHeight {
+		scale := math.Min(float64(previewMaxWidth)/float64(outWidth), float64(previewMaxHeight)/float64(outHeight))
+		outWidth = int(math.Round(float64(outWidth) * scale))
+		outHeight = int(math.Round(float64(outHeight) * scale))
+		if outWidth < 1 {
+			outWidth = 1
+		}
+		if outHeight < 1 {
+			outHeight = 1
+		}
+	}
+
+	if outWidth != cropWidth || outHeight != cropHeight {
+		resized := image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+		xdraw.CatmullRom.Scale(resized, resized.Bounds(), cropped, cropped.Bounds(), xdraw.Over, nil)
+		cropped = resized
+	}
+	return cropped, nil
+}
@@ -0,0 +1,190 @@
+package compiler
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+const testProjectJSON = `{
+	"title": "Rainy \"night\"\ncity",
+	"description": "Line one\nLine two",
+	"preview": "preview.png",
+	"type": "Video",
+	"file": "video.mp4",
+	"tags": ["Anime", "Relaxing"],
+	"contentrating": "Everyone",
+	"workshopid": 123456789,
+	"general": {
+		"properties": {
+			"speed": {"type": "slider", "text": "Speed", "value": 1.5, "order": 2, "min": 0.1, "max": 10, "step": 0.1},
+			"mode": {"type": "combo", "text": "Mode", "value": "2", "order": "1",
+				"options": [{"label": "Calm", "value": "1"}, {"label": "Storm", "value": 2}]},
+			"rain": {"type": "bool", "text": "Rain", "value": true},
+			"title": {"type": "textinput", "text": "Title", "value": null},
+			"schemecolor": {"type": "color", "text": "Scheme color", "value": "0.1 0.2 0.3", "order": 0},
+			"music": {"type": "directory", "text": "Music folder"},
+			"notice": {"type": "text", "text": "Just a label"}
+		}
+	}
+}`
+
+func TestAddMetadata(t *testing.T) {
+	projectDir := t.TempDir()
+	projectPath := filepath.Join(projectDir, "project.json")
+	if err := os.WriteFile(projectPath, []byte(testProjectJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previewFile, err := os.Create(filepath.Join(projectDir, "preview.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(previewFile, image.NewRGBA(image.Rect(0, 0, 32, 18))); err != nil {
+		t.Fatal(err)
+	}
+	_ = previewFile.Close()
+	sourcePath := filepath.Join(projectDir, "video.mp4")
+	if err := os.WriteFile(sourcePath, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := loadProject(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := newArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.close()
+	job := &compileJob{archive: archive}
+	job.addMetadata(project, projectDir, sourcePath, "video.mp4", nil)
+	if len(job.warnings) != 0 || job.outputErr != nil {
+		t.Fatalf("warnings %v, output error %v", job.warnings, job.outputErr)
+	}
+	if _, err := archive.read("preview.webp"); err != nil {
+		t.Errorf("preview.webp is missing: %v", err)
+	}
+
+	metadataBytes, err := archive.read("metadata.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(metadataBytes)
+	if strings.Contains(text, "\n ") || strings.Contains(text, "\n\t") {
+		t.Errorf("metadata.toml is indented:\n%s", text)
+	}
+	if strings.Index(text, "[options.mode]") > strings.Index(text, "[options.speed]") {
+		t.Errorf("options are not sorted by name:\n%s", text)
+	}
+
+	decoded := Metadata{}
+	if _, err := toml.Decode(text, &decoded); err != nil {
+		t.Fatalf("metadata.toml does not parse: %v\n%s", err, text)
+	}
+	float := func(value float64) *float64 { return &value }
+	str := func(value string) *string { return &value }
+	expected := Metadata{
+		Info: MetadataInfo{
+			Name:          "Rainy \"night\"\ncity",
+			Description:   "Line one\nLine two",
+			Preview:       "preview.webp",
+			Tags:          []string{"Anime", "Relaxing"},
+			ContentRating: "Everyone",
+		},
+		Video: &MetadataVideo{File: "video.mp4"},
+		Source: MetadataSource{
+			Type:       "Video",
+			WorkshopID: "123456789",
+			File:       "video.mp4",
+			Compiler:   "wpe-compile " + compilerVersion(),
+		},
+		Options: map[string]MetadataOption{
+			"speed": {Type: "slider", Label: "Speed", Order: 2, Default: str("1.5"), Min: float(0.1), Max: float(10),
+				Step: float(0.1)},
+			"mode": {Type: "combo", Label: "Mode", Order: 1, Default: str("2"), Values: []string{"1", "2"},
+				Labels: []string{"Calm", "Storm"}},
+			"rain":        {Type: "bool", Label: "Rain", Default: str("true")},
+			"title":       {Type: "textinput", Label: "Title"},
+			"schemecolor": {Type: "color", Label: "Scheme color", Default: str("0.1 0.2 0.3")},
+		},
+	}
+	expected.Source.SHA256, err = hashFile(sourcePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("metadata.toml decodes to\n%+v\nwant\n%+v\n%s", decoded, expected, text)
+	}
+}
+
+func TestDefaultProjectTitle(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/workshop/123456/scene.pkg", "123456"},
+		{"/workshop/123456/Scene.PKG", "123456"},
+		{"/wallpapers/forest.pkg", "forest"},
+		{"/wallpapers/forest", "forest"},
+		{"/wallpapers/forest/", "forest"},
+		{"/wallpapers/rain.mp4", "rain"},
+	}
+	for _, test := range tests {
+		if title := defaultProjectTitle(test.input); title != test.expected {
+			t.Errorf("defaultProjectTitle(%q) = %q, want %q", test.input, title, test.expected)
+		}
+	}
+}
+
+func TestMakeMetadataKeepsSourceType(t *testing.T) {
+	tests := []struct {
+		name     string
+		project  string
+		expected string
+	}{
+		{"no project", "", "scene"},
+		{"scene project", `{"title": "Scene", "type": "scene"}`, "scene"},
+		{"web project with a scene", `{"title": "Web", "type": "web"}`, "web"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projectDir := t.TempDir()
+			projectPath := ""
+			if test.project != "" {
+				projectPath = filepath.Join(projectDir, "project.json")
+				if err := os.WriteFile(projectPath, []byte(test.project), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			archive, err := newArchive(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.close()
+			job := &compileJob{archive: archive}
+			job.makeMetadata(projectPath, projectDir, nil)
+
+			metadataBytes, err := archive.read("metadata.toml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := Metadata{}
+			if _, err := toml.Decode(string(metadataBytes), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Source.Type != test.expected {
+				t.Errorf("source type = %q, want %q", decoded.Source.Type, test.expected)
+			}
+			if decoded.Video != nil {
+				t.Errorf("scene output has a video section")
+			}
+		})
+	}
+}
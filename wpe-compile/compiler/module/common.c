@@ -181,6 +181,80 @@ void wpe_resolve_object_parents() {
     }
 }
 
+static bool user_option_bool(const wpe_user_binding* binding, const char* value) {
+    if(binding->condition != NULL) {
+        return strcmp(value, binding->condition) == 0;
+    }
+    return strcmp(value, "true") == 0 || strcmp(value, "1") == 0;
+}
+
+static int user_option_floats(const char* value, float* result, int max_count) {
+    int count = 0;
+    while(count < max_count) {
+        while(*value == ' ' || *value == ',') {
+            value++;
+        }
+        char* end = NULL;
+        float parsed = strtof(value, &end);
+        if(end == value) {
+            break;
+        }
+        result[count++] = parsed;
+        value = end;
+    }
+    return count;
+}
+
+static void apply_user_binding(wpe_object* object, const wpe_user_binding* binding, const char* value) {
+    float values[3] = {0};
+    int count = 0;
+    switch(binding->field) {
+        case USER_FIELD_VISIBLE:
+            object->visible = user_option_bool(binding, value);
+            break;
+        case USER_FIELD_ALPHA:
+            if(object->type == OBJECTTYPE_IMAGE && user_option_floats(value, values, 1) == 1) {
+                object->image.alpha = values[0];
+            }
+            break;
+        case USER_FIELD_BRIGHTNESS:
+            if(object->type == OBJECTTYPE_IMAGE && user_option_floats(value, values, 1) == 1) {
+                object->image.brightness = values[0];
+            }
+            break;
+        case USER_FIELD_COLOR:
+            count = user_option_floats(value, values, 3);
+            if(object->type == OBJECTTYPE_IMAGE && (count == 1 || count == 3)) {
+                for(int i = 0; i < 3; i++) {
+                    object->image.color.at[i] = values[count == 1 ? 0 : i];
+                }
+            }
+            break;
+    }
+}
+
+void wpe_apply_user_bindings(wpe_object* object) {
+    for(int i = 0; i < object->num_user_bindings; i++) {
+        const char* value = ow_get_option(object->user_bindings[i].option);
+        if(value != NULL) {
+            apply_user_binding(object, &object->user_bindings[i], value);
+        }
+    }
+
+    if(object->type != OBJECTTYPE_IMAGE) {
+        return;
+    }
+    for(int i = 0; i < object->image.num_effects; i++) {
+        wpe_image_effect* effect = &object->image.effects[i];
+        for(int j = 0; j < effect->num_user_bindings; j++) {
+            const char* value = ow_get_option(effect->user_bindings[j].option);
+            if(value != NULL && effect->user_bindings[j].field == USER_FIELD_VISIBLE) {
+                effect->visible = user_option_bool(&effect->user_bindings[j], value);
+            }
+        }
+    }
+}
+
 wpe_texture* wpe_material_texture_at(wpe_material* material, int slot) {
     if(slot < 0 || slot >= material->num_textures || material->textures == NULL) {
         return NULL;
@@ -172,9 +172,24 @@ typedef struct wpe_effect_fbo {
     uint32_t height;
 } wpe_effect_fbo;
 
+typedef enum {
+    USER_FIELD_VISIBLE,
+    USER_FIELD_ALPHA,
+    USER_FIELD_COLOR,
+    USER_FIELD_BRIGHTNESS,
+} wpe_user_field;
+
+typedef struct {
+    wpe_user_field field;
+    const char* option;
+    const char* condition;
+} wpe_user_binding;
+
 typedef struct {
     const char* name;
     bool visible;
+    wpe_user_binding* user_bindings;
+    int num_user_bindings;
     wpe_material_pass* passes;
     int num_passes;
     wpe_effect_fbo* fbos;
@@ -477,6 +492,8 @@ typedef struct wpe_object {
     int parent;
     struct wpe_object* parent_object;
     bool visible;
+    wpe_user_binding* user_bindings;
+    int num_user_bindings;
     const char* name;
     const char* attachment;
     wpe_vec3 origin;
@@ -584,11 +601,9 @@ typedef struct {
     int audio_spectrum_size;
 } wpe_renderer_state;
 
-#if defined(SCENE) && defined(WPE_COMPILE_SCENE_DEFINE)
-#include "scene.h"
-#else
 extern wpe_scene scene;
-#endif
+
+bool wpe_load_scene(const char* path);
 
 wpe_mat4 wpe_mat4_identity();
 wpe_mat4 wpe_mat4_inverse_affine(wpe_mat4 m);
@@ -605,6 +620,7 @@ wpe_texture* wpe_find_texture_by_name(const char* name);
 wpe_shader* wpe_find_shader(int id);
 wpe_object* wpe_find_object(int id);
 void wpe_resolve_object_parents();
+void wpe_apply_user_bindings(wpe_object* object);
 wpe_texture* wpe_material_texture_at(wpe_material* material, int slot);
 wpe_effect_fbo* wpe_find_effect_fbo(wpe_image_effect* effect, const char* name);
 
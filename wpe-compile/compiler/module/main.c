@@ -64,6 +64,12 @@ static void update_camera_state(float delta) {
 }
 
 __attribute__((export_name("init"))) void init() {
+    // Trapping makes init fail in wallpaperd, which then reports the scene as broken instead of showing nothing.
+    if(!wpe_load_scene("scene.bin")) {
+        printf("error: loading scene.bin failed\n");
+        abort();
+    }
+
     const char* scale_mode = ow_get_option("scale-mode");
     if(scale_mode != NULL) {
         if(strcmp(scale_mode, "stretch") == 0) {
@@ -82,6 +88,10 @@ __attribute__((export_name("init"))) void init() {
         state.audio_spectrum = calloc((size_t)state.audio_spectrum_size, sizeof(float));
     }
 
+    for(size_t i = 0; i < scene.num_objects; i++) {
+        wpe_apply_user_bindings(&scene.objects[i]);
+    }
+
     ow_begin_copy_pass();
     wpe_renderer_init();
     for(size_t i = 0; i < scene.num_objects; i++) {
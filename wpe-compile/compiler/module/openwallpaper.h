@@ -0,0 +1 @@
+../../../include/openwallpaper.h
\ No newline at end of file
@@ -0,0 +1,518 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include "defs.h"
+
+#define WPE_SCENE_DATA_VERSION 1u
+#define WPE_SCENE_DATA_NULL_STRING UINT32_MAX
+
+wpe_scene scene;
+
+typedef struct {
+    uint8_t* data;
+    size_t size;
+    size_t offset;
+    bool failed;
+} wpe_scene_reader;
+
+static bool scene_read_bytes(wpe_scene_reader* reader, void* out, size_t size) {
+    if(reader->failed || size > reader->size - reader->offset) {
+        reader->failed = true;
+        return false;
+    }
+    if(out != NULL && size > 0) {
+        memcpy(out, reader->data + reader->offset, size);
+    }
+    reader->offset += size;
+    return true;
+}
+
+static uint32_t scene_read_u32(wpe_scene_reader* reader) {
+    uint8_t data[4] = {0};
+    (void)scene_read_bytes(reader, data, sizeof(data));
+    return (uint32_t)data[0] | ((uint32_t)data[1] << 8) | ((uint32_t)data[2] << 16) | ((uint32_t)data[3] << 24);
+}
+
+static int scene_read_int(wpe_scene_reader* reader) {
+    return (int32_t)scene_read_u32(reader);
+}
+
+static bool scene_read_bool(wpe_scene_reader* reader) {
+    uint8_t value = 0;
+    (void)scene_read_bytes(reader, &value, sizeof(value));
+    return value != 0;
+}
+
+static float scene_read_float(wpe_scene_reader* reader) {
+    uint32_t bits = scene_read_u32(reader);
+    float value = 0.0f;
+    memcpy(&value, &bits, sizeof(value));
+    return value;
+}
+
+static void scene_read_floats(wpe_scene_reader* reader, float* values, int count) {
+    for(int i = 0; i < count; i++) {
+        values[i] = scene_read_float(reader);
+    }
+}
+
+static void scene_read_ints(wpe_scene_reader* reader, int* values, int count) {
+    for(int i = 0; i < count; i++) {
+        values[i] = scene_read_int(reader);
+    }
+}
+
+// Strings are stored with their length and a terminating zero, so they point into the scene data.
+static const char* scene_read_string(wpe_scene_reader* reader) {
+    uint32_t len = scene_read_u32(reader);
+    if(reader->failed || len == WPE_SCENE_DATA_NULL_STRING) {
+        return NULL;
+    }
+    if(len >= reader->size - reader->offset || reader->data[reader->offset + len] != 0) {
+        reader->failed = true;
+        return NULL;
+    }
+    const char* value = (const char*)(reader->data + reader->offset);
+    reader->offset += len + 1;
+    return value;
+}
+
+// scene_read_array reads an element count and allocates zeroed elements for it, every element takes at least
+// one byte of scene data, so larger counts mean that the data is broken.
+static void* scene_read_array(wpe_scene_reader* reader, int* count_out, size_t element_size) {
+    uint32_t count = scene_read_u32(reader);
+    *count_out = 0;
+    if(reader->failed || count == 0) {
+        return NULL;
+    }
+    if(count > reader->size - reader->offset) {
+        reader->failed = true;
+        return NULL;
+    }
+    void* values = calloc(count, element_size);
+    if(values == NULL) {
+        reader->failed = true;
+        return NULL;
+    }
+    *count_out = (int)count;
+    return values;
+}
+
+static const float* scene_read_float_array(wpe_scene_reader* reader, int* count_out) {
+    float* values = scene_read_array(reader, count_out, sizeof(float));
+    if(values != NULL) {
+        scene_read_floats(reader, values, *count_out);
+    }
+    return values;
+}
+
+static void scene_read_vec2(wpe_scene_reader* reader, wpe_vec2* value) {
+    scene_read_floats(reader, value->at, 2);
+}
+
+static void scene_read_vec3(wpe_scene_reader* reader, wpe_vec3* value) {
+    scene_read_floats(reader, value->at, 3);
+}
+
+static void scene_read_texture(wpe_scene_reader* reader, wpe_texture* texture) {
+    texture->id = scene_read_int(reader);
+    texture->name = scene_read_string(reader);
+    texture->width = scene_read_int(reader);
+    texture->height = scene_read_int(reader);
+    texture->clamp_uv = scene_read_bool(reader);
+    texture->interpolation = scene_read_bool(reader);
+}
+
+static wpe_uniform_info* scene_read_uniforms(wpe_scene_reader* reader, int* count_out) {
+    wpe_uniform_info* uniforms = scene_read_array(reader, count_out, sizeof(wpe_uniform_info));
+    for(int i = 0; i < *count_out; i++) {
+        uniforms[i].name = scene_read_string(reader);
+        uniforms[i].constant_name = scene_read_string(reader);
+        uniforms[i].type = scene_read_string(reader);
+        uniforms[i].array_size = scene_read_int(reader);
+        uniforms[i].default_set = scene_read_bool(reader);
+        if(uniforms[i].default_set) {
+            uniforms[i].default_value = scene_read_float_array(reader, &uniforms[i].default_len);
+        }
+    }
+    return uniforms;
+}
+
+static wpe_attribute_info* scene_read_attributes(wpe_scene_reader* reader, int* count_out) {
+    wpe_attribute_info* attributes = scene_read_array(reader, count_out, sizeof(wpe_attribute_info));
+    for(int i = 0; i < *count_out; i++) {
+        attributes[i].name = scene_read_string(reader);
+        attributes[i].type = scene_read_string(reader);
+        attributes[i].array_size = scene_read_int(reader);
+    }
+    return attributes;
+}
+
+static wpe_sampler_info* scene_read_samplers(wpe_scene_reader* reader, int* count_out) {
+    wpe_sampler_info* samplers = scene_read_array(reader, count_out, sizeof(wpe_sampler_info));
+    for(int i = 0; i < *count_out; i++) {
+        samplers[i].name = scene_read_string(reader);
+        samplers[i].default_texture = scene_read_string(reader);
+        samplers[i].texture_slot = scene_read_int(reader);
+    }
+    return samplers;
+}
+
+static void scene_read_shader(wpe_scene_reader* reader, wpe_shader* shader) {
+    shader->id = scene_read_int(reader);
+    shader->name = scene_read_string(reader);
+    shader->vertex_uniforms = scene_read_uniforms(reader, &shader->num_vertex_uniforms);
+    shader->fragment_uniforms = scene_read_uniforms(reader, &shader->num_fragment_uniforms);
+    shader->attributes = scene_read_attributes(reader, &shader->num_attributes);
+    shader->samplers = scene_read_samplers(reader, &shader->num_samplers);
+}
+
+static wpe_user_binding* scene_read_user_bindings(wpe_scene_reader* reader, int* count_out) {
+    wpe_user_binding* bindings = scene_read_array(reader, count_out, sizeof(wpe_user_binding));
+    for(int i = 0; i < *count_out; i++) {
+        bindings[i].field = (wpe_user_field)scene_read_int(reader);
+        bindings[i].option = scene_read_string(reader);
+        bindings[i].condition = scene_read_string(reader);
+    }
+    return bindings;
+}
+
+static wpe_material_texture* scene_read_material_textures(wpe_scene_reader* reader, int* count_out) {
+    wpe_material_texture* textures = scene_read_array(reader, count_out, sizeof(wpe_material_texture));
+    for(int i = 0; i < *count_out; i++) {
+        textures[i].name = scene_read_string(reader);
+        textures[i].texture_id = scene_read_int(reader);
+    }
+    return textures;
+}
+
+static void scene_read_material(wpe_scene_reader* reader, wpe_material* material) {
+    material->blending = scene_read_string(reader);
+    material->shader_id = scene_read_int(reader);
+    material->textures = scene_read_material_textures(reader, &material->num_textures);
+}
+
+static wpe_material* scene_read_materials(wpe_scene_reader* reader, int* count_out) {
+    wpe_material* materials = scene_read_array(reader, count_out, sizeof(wpe_material));
+    for(int i = 0; i < *count_out; i++) {
+        scene_read_material(reader, &materials[i]);
+    }
+    return materials;
+}
+
+static wpe_material_pass* scene_read_passes(wpe_scene_reader* reader, int* count_out) {
+    wpe_material_pass* passes = scene_read_array(reader, count_out, sizeof(wpe_material_pass));
+    for(int i = 0; i < *count_out; i++) {
+        wpe_material_pass* pass = &passes[i];
+        pass->textures = scene_read_material_textures(reader, &pass->num_textures);
+        pass->constants = scene_read_array(reader, &pass->num_constants, sizeof(wpe_uniform_constant));
+        for(int j = 0; j < pass->num_constants; j++) {
+            pass->constants[j].name = scene_read_string(reader);
+            pass->constants[j].values = scene_read_float_array(reader, &pass->constants[j].len);
+        }
+        pass->target = scene_read_string(reader);
+        pass->binds = scene_read_array(reader, &pass->num_binds, sizeof(wpe_material_pass_bind));
+        for(int j = 0; j < pass->num_binds; j++) {
+            pass->binds[j].name = scene_read_string(reader);
+            pass->binds[j].index = scene_read_int(reader);
+        }
+    }
+    return passes;
+}
+
+static wpe_image_effect* scene_read_effects(wpe_scene_reader* reader, int* count_out) {
+    wpe_image_effect* effects = scene_read_array(reader, count_out, sizeof(wpe_image_effect));
+    for(int i = 0; i < *count_out; i++) {
+        wpe_image_effect* effect = &effects[i];
+        effect->name = scene_read_string(reader);
+        effect->visible = scene_read_bool(reader);
+        effect->user_bindings = scene_read_user_bindings(reader, &effect->num_user_bindings);
+        effect->passes = scene_read_passes(reader, &effect->num_passes);
+        effect->fbos = scene_read_array(reader, &effect->num_fbos, sizeof(wpe_effect_fbo));
+        for(int j = 0; j < effect->num_fbos; j++) {
+            effect->fbos[j].name = scene_read_string(reader);
+            effect->fbos[j].scale = scene_read_int(reader);
+        }
+        effect->materials = scene_read_materials(reader, &effect->num_materials);
+    }
+    return effects;
+}
+
+static wpe_puppet_model* scene_read_puppet(wpe_scene_reader* reader) {
+    if(!scene_read_bool(reader)) {
+        return NULL;
+    }
+    wpe_puppet_model* puppet = calloc(1, sizeof(wpe_puppet_model));
+    if(puppet == NULL) {
+        reader->failed = true;
+        return NULL;
+    }
+    puppet->path = scene_read_string(reader);
+    puppet->num_bones = scene_read_int(reader);
+    puppet->layers = scene_read_array(reader, &puppet->num_layers, sizeof(wpe_puppet_animation_layer));
+    for(int i = 0; i < puppet->num_layers; i++) {
+        wpe_puppet_animation_layer* layer = &puppet->layers[i];
+        layer->id = scene_read_int(reader);
+        layer->blend = scene_read_float(reader);
+        layer->rate = scene_read_float(reader);
+        layer->visible = scene_read_bool(reader);
+        layer->additive = scene_read_bool(reader);
+        layer->blend_in = scene_read_bool(reader);
+        layer->blend_out = scene_read_bool(reader);
+        layer->blend_time = scene_read_float(reader);
+    }
+    return puppet;
+}
+
+static void scene_read_object_common(wpe_scene_reader* reader, wpe_object* object) {
+    object->visible = scene_read_bool(reader);
+    object->user_bindings = scene_read_user_bindings(reader, &object->num_user_bindings);
+    object->name = scene_read_string(reader);
+    object->attachment = scene_read_string(reader);
+    scene_read_vec3(reader, &object->origin);
+    scene_read_vec3(reader, &object->scale);
+    scene_read_vec3(reader, &object->angles);
+}
+
+static void scene_read_image_object(wpe_scene_reader* reader, wpe_object* object) {
+    scene_read_object_common(reader, object);
+    scene_read_vec2(reader, &object->size);
+    object->perspective = scene_read_bool(reader);
+    scene_read_vec2(reader, &object->parallax_depth);
+
+    wpe_image_object* image = &object->image;
+    scene_read_vec3(reader, &image->color);
+    image->color_blend_mode = scene_read_int(reader);
+    image->alpha = scene_read_float(reader);
+    image->brightness = scene_read_float(reader);
+    image->fullscreen = scene_read_bool(reader);
+    image->composition_layer = scene_read_bool(reader);
+    image->passthrough = scene_read_bool(reader);
+    scene_read_material(reader, &image->material);
+    image->effects = scene_read_effects(reader, &image->num_effects);
+    if(scene_read_bool(reader)) {
+        scene_read_material(reader, &image->puppet_material);
+    }
+    image->puppet = scene_read_puppet(reader);
+}
+
+static void scene_read_particle_emitters(wpe_scene_reader* reader, wpe_particle_object* particle) {
+    particle->emitters = scene_read_array(reader, &particle->num_emitters, sizeof(wpe_particle_emitter));
+    for(int i = 0; i < particle->num_emitters; i++) {
+        wpe_particle_emitter* emitter = &particle->emitters[i];
+        scene_read_floats(reader, emitter->directions, 3);
+        scene_read_floats(reader, emitter->distance_max, 3);
+        scene_read_floats(reader, emitter->distance_min, 3);
+        scene_read_floats(reader, emitter->origin, 3);
+        scene_read_ints(reader, emitter->sign, 3);
+        emitter->speed_min = scene_read_float(reader);
+        emitter->speed_max = scene_read_float(reader);
+        emitter->rate = scene_read_float(reader);
+    }
+}
+
+static void scene_read_particle_initializer(wpe_scene_reader* reader, wpe_particle_initializer* init) {
+    init->min_lifetime = scene_read_float(reader);
+    init->max_lifetime = scene_read_float(reader);
+    init->min_size = scene_read_float(reader);
+    init->max_size = scene_read_float(reader);
+    scene_read_floats(reader, init->min_velocity, 3);
+    scene_read_floats(reader, init->max_velocity, 3);
+    scene_read_floats(reader, init->min_rotation, 3);
+    scene_read_floats(reader, init->max_rotation, 3);
+    scene_read_floats(reader, init->min_angular_velocity, 3);
+    scene_read_floats(reader, init->max_angular_velocity, 3);
+    scene_read_floats(reader, init->min_color, 3);
+    scene_read_floats(reader, init->max_color, 3);
+    init->min_alpha = scene_read_float(reader);
+    init->max_alpha = scene_read_float(reader);
+    init->turbulent_velocity = scene_read_bool(reader);
+    init->turbulent_scale = scene_read_float(reader);
+    init->turbulent_time_scale = scene_read_float(reader);
+    init->turbulent_offset = scene_read_float(reader);
+    init->turbulent_speed_min = scene_read_float(reader);
+    init->turbulent_speed_max = scene_read_float(reader);
+    init->turbulent_phase_min = scene_read_float(reader);
+    init->turbulent_phase_max = scene_read_float(reader);
+    scene_read_floats(reader, init->turbulent_forward, 3);
+    scene_read_floats(reader, init->turbulent_right, 3);
+    init->turbulent_audio.mode = scene_read_int(reader);
+    init->turbulent_audio.exponent = scene_read_float(reader);
+    scene_read_floats(reader, init->turbulent_audio.bounds, 2);
+    init->turbulent_audio.frequency_start = scene_read_int(reader);
+    init->turbulent_audio.frequency_end = scene_read_int(reader);
+}
+
+static void scene_read_oscillate_scalar(wpe_scene_reader* reader, wpe_particle_oscillate_scalar_operator* oscillate) {
+    oscillate->enabled = scene_read_bool(reader);
+    oscillate->frequency_min = scene_read_float(reader);
+    oscillate->frequency_max = scene_read_float(reader);
+    oscillate->phase_min = scene_read_float(reader);
+    oscillate->phase_max = scene_read_float(reader);
+    oscillate->scale_min = scene_read_float(reader);
+    oscillate->scale_max = scene_read_float(reader);
+}
+
+static void scene_read_particle_operator(wpe_scene_reader* reader, wpe_particle_operator* operator) {
+    operator->movement.enabled = scene_read_bool(reader);
+    scene_read_floats(reader, operator->movement.gravity, 3);
+    operator->movement.drag = scene_read_float(reader);
+    operator->movement.speed = scene_read_float(reader);
+
+    operator->angular_movement.enabled = scene_read_bool(reader);
+    operator->angular_movement.drag = scene_read_float(reader);
+    scene_read_floats(reader, operator->angular_movement.force, 3);
+
+    operator->size_change.enabled = scene_read_bool(reader);
+    operator->size_change.start_time = scene_read_float(reader);
+    operator->size_change.end_time = scene_read_float(reader);
+    operator->size_change.start_value = scene_read_float(reader);
+    operator->size_change.end_value = scene_read_float(reader);
+
+    operator->color_change.enabled = scene_read_bool(reader);
+    operator->color_change.start_time = scene_read_float(reader);
+    operator->color_change.end_time = scene_read_float(reader);
+    scene_read_floats(reader, operator->color_change.start_value, 3);
+    scene_read_floats(reader, operator->color_change.end_value, 3);
+
+    operator->alpha_fade.enabled = scene_read_bool(reader);
+    operator->alpha_fade.fade_in_time = scene_read_float(reader);
+    operator->alpha_fade.fade_out_time = scene_read_float(reader);
+
+    operator->oscillate_position.enabled = scene_read_bool(reader);
+    scene_read_floats(reader, operator->oscillate_position.mask, 3);
+    operator->oscillate_position.frequency_min = scene_read_float(reader);
+    operator->oscillate_position.frequency_max = scene_read_float(reader);
+    operator->oscillate_position.phase_min = scene_read_float(reader);
+    operator->oscillate_position.phase_max = scene_read_float(reader);
+    operator->oscillate_position.scale_min = scene_read_float(reader);
+    operator->oscillate_position.scale_max = scene_read_float(reader);
+
+    scene_read_oscillate_scalar(reader, &operator->oscillate_alpha);
+    scene_read_oscillate_scalar(reader, &operator->oscillate_size);
+}
+
+static void scene_read_particle_object(wpe_scene_reader* reader, wpe_object* object) {
+    scene_read_object_common(reader, object);
+    object->size.x = 2.0f;
+    object->size.y = 2.0f;
+    object->perspective = scene_read_bool(reader);
+    scene_read_vec2(reader, &object->parallax_depth);
+
+    wpe_particle_object* particle = &object->particle;
+    scene_read_material(reader, &particle->material);
+    scene_read_particle_emitters(reader, particle);
+    scene_read_particle_initializer(reader, &particle->init);
+    scene_read_particle_operator(reader, &particle->operator);
+    particle->max_count = scene_read_int(reader);
+    particle->start_time = scene_read_float(reader);
+    particle->sequence_multiplier = scene_read_float(reader);
+    particle->random_frame = scene_read_bool(reader);
+    particle->spritesheet_cols = scene_read_int(reader);
+    particle->spritesheet_rows = scene_read_int(reader);
+    particle->spritesheet_frames = scene_read_int(reader);
+    particle->texture_ratio = scene_read_float(reader);
+}
+
+static void scene_read_empty_object(wpe_scene_reader* reader, wpe_object* object) {
+    object->name = "";
+    scene_read_vec3(reader, &object->origin);
+    scene_read_vec3(reader, &object->scale);
+    scene_read_vec3(reader, &object->angles);
+}
+
+static void scene_read_object(wpe_scene_reader* reader, wpe_object* object) {
+    object->type = (wpe_object_type)scene_read_int(reader);
+    object->id = scene_read_int(reader);
+    object->parent = scene_read_int(reader);
+    switch(object->type) {
+        case OBJECTTYPE_IMAGE:
+            scene_read_image_object(reader, object);
+            break;
+        case OBJECTTYPE_PARTICLE:
+            scene_read_particle_object(reader, object);
+            break;
+        case OBJECTTYPE_EMPTY:
+            scene_read_empty_object(reader, object);
+            break;
+        default:
+            reader->failed = true;
+            break;
+    }
+}
+
+static void scene_read_general(wpe_scene_reader* reader, wpe_scene_general* general) {
+    general->parallax = scene_read_bool(reader);
+    general->parallax_amount = scene_read_float(reader);
+    general->parallax_delay = scene_read_float(reader);
+    general->parallax_mouse_influence = scene_read_float(reader);
+    general->shake = scene_read_bool(reader);
+    general->shake_amplitude = scene_read_float(reader);
+    general->shake_roughness = scene_read_float(reader);
+    general->shake_speed = scene_read_float(reader);
+    general->clear_enabled = scene_read_bool(reader);
+    scene_read_vec3(reader, &general->clear_color);
+    scene_read_vec2(reader, &general->ortho);
+    general->zoom = scene_read_float(reader);
+    general->fov = scene_read_float(reader);
+    general->near_z = scene_read_float(reader);
+    general->far_z = scene_read_float(reader);
+}
+
+static bool scene_read(wpe_scene_reader* reader, wpe_scene* result) {
+    char magic[4] = {0};
+    if(!scene_read_bytes(reader, magic, sizeof(magic)) || memcmp(magic, "WPES", sizeof(magic)) != 0) {
+        printf("error: scene data has no WPES header\n");
+        return false;
+    }
+    uint32_t version = scene_read_u32(reader);
+    if(version != WPE_SCENE_DATA_VERSION) {
+        printf("error: scene data version %u is not supported, expected %u\n", version, WPE_SCENE_DATA_VERSION);
+        return false;
+    }
+
+    int count = 0;
+    result->textures = scene_read_array(reader, &count, sizeof(wpe_texture));
+    result->num_textures = (size_t)count;
+    for(size_t i = 0; i < result->num_textures; i++) {
+        scene_read_texture(reader, &result->textures[i]);
+    }
+    result->shaders = scene_read_array(reader, &count, sizeof(wpe_shader));
+    result->num_shaders = (size_t)count;
+    for(size_t i = 0; i < result->num_shaders; i++) {
+        scene_read_shader(reader, &result->shaders[i]);
+    }
+    result->objects = scene_read_array(reader, &count, sizeof(wpe_object));
+    result->num_objects = (size_t)count;
+    for(size_t i = 0; i < result->num_objects; i++) {
+        scene_read_object(reader, &result->objects[i]);
+    }
+    scene_read_general(reader, &result->general);
+    result->passthrough_shader_id = scene_read_int(reader);
+    result->audio_spectrum_size = scene_read_int(reader);
+
+    if(reader->failed || reader->offset != reader->size) {
+        printf("error: scene data is broken\n");
+        return false;
+    }
+    return true;
+}
+
+bool wpe_load_scene(const char* path) {
+    size_t size = ow_get_file_size(path);
+    uint8_t* data = malloc(size);
+    if(data == NULL) {
+        return false;
+    }
+    ow_read_file(path, data);
+
+    // Strings point into data, so it is kept for the lifetime of the scene. A scene that failed to load is leaked,
+    // init aborts in that case anyway.
+    wpe_scene_reader reader = {.data = data, .size = size};
+    wpe_scene result = {0};
+    if(!scene_read(&reader, &result)) {
+        return false;
+    }
+    scene = result;
+    return true;
+}
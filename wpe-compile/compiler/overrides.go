@@ -0,0 +1,174 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+type UserOverrides map[string]json.RawMessage
+
+func LoadUserOverrides(overridesPath string, assignments []string) (UserOverrides, error) {
+	overrides := UserOverrides{}
+	if overridesPath != "" {
+		overridesBytes, err := os.ReadFile(overridesPath)
+		if err != nil {
+			return nil, NewError(InputError, fmt.Errorf("failed to load overrides file: %w", err))
+		}
+		if err := json.Unmarshal(overridesBytes, &overrides); err != nil {
+			return nil, NewError(InputError, fmt.Errorf("failed to parse overrides file %s: %w", overridesPath, err))
+		}
+	}
+
+	for _, assignment := range assignments {
+		name, value, found := strings.Cut(assignment, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, NewError(InputError, fmt.Errorf("invalid override %q, expected name=value", assignment))
+		}
+		overrides[name] = overrideValueFromText(value)
+	}
+	return overrides, nil
+}
+
+func overrideValueFromText(text string) json.RawMessage {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		switch value.(type) {
+		case bool, float64, string:
+			return json.RawMessage(text)
+		}
+	}
+	quoted, _ := json.Marshal(text)
+	return quoted
+}
+
+func (overrides UserOverrides) resolve(raw json.RawMessage) (json.RawMessage, bool) {
+	binding, ok := parseUserBinding(raw, UserFieldVisible)
+	if !ok {
+		return nil, false
+	}
+	value, exists := overrides[binding.Property]
+	if !exists {
+		return nil, false
+	}
+	if binding.HasCondition {
+		if rawOptionValue(value) == binding.Condition {
+			return json.RawMessage("true"), true
+		}
+		return json.RawMessage("false"), true
+	}
+	return value, true
+}
+
+func (overrides UserOverrides) apply(raw json.RawMessage) (json.RawMessage, error) {
+	if len(overrides) == 0 || bytesFromRawNullAware(raw) == nil {
+		return raw, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("cannot parse JSON: %w", err)
+	}
+	document, err := overrides.applyToValue(document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func (overrides UserOverrides) applyToValue(value any) (any, error) {
+	switch value := value.(type) {
+	case map[string]any:
+		if _, bound := value["user"]; bound {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			if resolved, ok := overrides.resolve(raw); ok {
+				return resolved, nil
+			}
+		}
+		for key, item := range value {
+			resolved, err := overrides.applyToValue(item)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = resolved
+		}
+		return value, nil
+	case []any:
+		for index, item := range value {
+			resolved, err := overrides.applyToValue(item)
+			if err != nil {
+				return nil, err
+			}
+			value[index] = resolved
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+func (overrides UserOverrides) hidesObject(raw json.RawMessage) (bool, error) {
+	var object struct {
+		Visible json.RawMessage `json:"visible"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return false, fmt.Errorf("cannot parse object entry: %w", err)
+	}
+	resolved, ok := overrides.resolve(object.Visible)
+	if !ok {
+		return false, nil
+	}
+	visible, err := parseBoolFromRaw(resolved)
+	if err != nil {
+		binding, _ := parseUserBinding(object.Visible, UserFieldVisible)
+		return false, fmt.Errorf("property %s is bound to visible and must be a bool: %w", binding.Property, err)
+	}
+	return !visible, nil
+}
+
+// unusedNames returns the overridden names, sorted, that are neither a property in project.json nor bound to anything
+// in scene.json. Those are most likely typos.
+func (overrides UserOverrides) unusedNames(sceneBytes []byte, properties map[string]ProjectProperty) []string {
+	bound := map[string]bool{}
+	var document any
+	if err := json.Unmarshal(sceneBytes, &document); err == nil {
+		collectBoundProperties(document, bound)
+	}
+	unused := []string{}
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		if _, exists := properties[name]; !exists && !bound[name] {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+func collectBoundProperties(value any, bound map[string]bool) {
+	switch value := value.(type) {
+	case map[string]any:
+		if _, isBinding := value["user"]; isBinding {
+			raw, err := json.Marshal(value)
+			if err == nil {
+				if binding, ok := parseUserBinding(raw, UserFieldVisible); ok {
+					bound[binding.Property] = true
+				}
+			}
+		}
+		for _, item := range value {
+			collectBoundProperties(item, bound)
+		}
+	case []any:
+		for _, item := range value {
+			collectBoundProperties(item, bound)
+		}
+	}
+}
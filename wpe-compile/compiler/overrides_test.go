@@ -0,0 +1,188 @@
+package compiler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLoadUserOverrides(t *testing.T) {
+	overridesPath := filepath.Join(t.TempDir(), "overrides.json")
+	if err := os.WriteFile(overridesPath, []byte(`{"speed": 2, "title": "file"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		assignments []string
+		expected    map[string]string
+		err         bool
+	}{
+		{"number", "", []string{"speed=1.5"}, map[string]string{"speed": `1.5`}, false},
+		{"bool", "", []string{"show=false"}, map[string]string{"show": `false`}, false},
+		{"quoted string", "", []string{`title="a b"`}, map[string]string{"title": `"a b"`}, false},
+		{"bare text", "", []string{"color=1 0.5 0"}, map[string]string{"color": `"1 0.5 0"`}, false},
+		{"empty value", "", []string{"title="}, map[string]string{"title": `""`}, false},
+		{"name is trimmed", "", []string{" speed =3"}, map[string]string{"speed": `3`}, false},
+		{"set overrides file", overridesPath, []string{"title=set"}, map[string]string{"speed": `2`, "title": `"set"`},
+			false},
+		{"missing value", "", []string{"speed"}, nil, true},
+		{"missing name", "", []string{"=1"}, nil, true},
+		{"missing file", filepath.Join(t.TempDir(), "missing.json"), nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overrides, err := LoadUserOverrides(test.path, test.assignments)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", overrides)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(overrides) != len(test.expected) {
+				t.Fatalf("got %d overrides, want %d", len(overrides), len(test.expected))
+			}
+			for name, value := range test.expected {
+				if string(overrides[name]) != value {
+					t.Errorf("%s = %s, want %s", name, overrides[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestUserOverridesApply(t *testing.T) {
+	overrides := UserOverrides{"opacity": json.RawMessage(`0.25`), "mode": json.RawMessage(`"2"`)}
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{"plain binding", `{"alpha":{"user":"opacity","value":1}}`, `{"alpha":0.25}`},
+		{"matching condition", `{"visible":{"user":{"name":"mode","condition":"2"},"value":false}}`,
+			`{"visible":true}`},
+		{"other condition", `{"visible":{"user":{"name":"mode","condition":"1"},"value":true}}`,
+			`{"visible":false}`},
+		{"nested in array", `{"effects":[{"alpha":{"user":"opacity","value":1}}]}`, `{"effects":[{"alpha":0.25}]}`},
+		{"unset property", `{"alpha":{"user":"other","value":1}}`, `{"alpha":{"user":"other","value":1}}`},
+		{"no bindings", `{"alpha":1,"name":"x"}`, `{"alpha":1,"name":"x"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := overrides.apply(json.RawMessage(test.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual, expected any
+			if err := json.Unmarshal(result, &actual); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			actualJSON, _ := json.Marshal(actual)
+			expectedJSON, _ := json.Marshal(expected)
+			if string(actualJSON) != string(expectedJSON) {
+				t.Errorf("apply = %s, want %s", actualJSON, expectedJSON)
+			}
+		})
+	}
+
+	if _, err := overrides.apply(json.RawMessage(`{"alpha":`)); err == nil {
+		t.Error("applying to broken JSON succeeded")
+	}
+}
+
+func TestUserOverridesHidesObject(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides UserOverrides
+		raw       string
+		hidden    bool
+		err       bool
+	}{
+		{"hidden", UserOverrides{"show": json.RawMessage(`false`)}, `{"visible":{"user":"show","value":true}}`, true,
+			false},
+		{"shown", UserOverrides{"show": json.RawMessage(`true`)}, `{"visible":{"user":"show","value":false}}`, false,
+			false},
+		{"not bound", UserOverrides{"show": json.RawMessage(`false`)}, `{"visible":true}`, false, false},
+		{"not a bool", UserOverrides{"show": json.RawMessage(`"maybe"`)}, `{"visible":{"user":"show"}}`, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hidden, err := test.overrides.hidesObject(json.RawMessage(test.raw))
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want error %v", err, test.err)
+			}
+			if hidden != test.hidden {
+				t.Errorf("hidden = %v, want %v", hidden, test.hidden)
+			}
+		})
+	}
+}
+
+func TestUserOverridesUnusedNames(t *testing.T) {
+	scene := []byte(`{"objects":[{"visible":{"user":"show"},"effects":[{"alpha":{"user":{"name":"mode","condition":"1"}}}]}]}`)
+	properties := map[string]ProjectProperty{"schemecolor": {Type: "color"}}
+	overrides := UserOverrides{
+		"show":         json.RawMessage(`false`),
+		"mode":         json.RawMessage(`"1"`),
+		"schemecolor":  json.RawMessage(`"1 0 0"`),
+		"schemecolour": json.RawMessage(`"1 0 0"`),
+		"shwo":         json.RawMessage(`true`),
+	}
+	unused := overrides.unusedNames(scene, properties)
+	if !slices.Equal(unused, []string{"schemecolour", "shwo"}) {
+		t.Errorf("unused = %v, want [schemecolour shwo]", unused)
+	}
+	if unused := overrides.unusedNames([]byte("not json"), nil); len(unused) != len(overrides) {
+		t.Errorf("unused without a scene = %v, want every name", unused)
+	}
+}
+
+func TestReportHiddenObjects(t *testing.T) {
+	projectDir := t.TempDir()
+	sceneJSON := `{"general": {}, "objects": [
+		{"id": 1, "name": "sky"},
+		{"id": 2, "name": "rain", "visible": {"user": "rain", "value": true}},
+		{"id": 3, "name": "drops", "parent": 2},
+		{"id": 4, "name": "clouds", "visible": {"user": {"name": "weather", "condition": "1"}, "value": true}}
+	]}`
+	if err := os.WriteFile(filepath.Join(projectDir, "scene.json"), []byte(sceneJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assets, err := OpenAssets(projectDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+
+	overrides := UserOverrides{"rain": json.RawMessage(`false`), "weather": json.RawMessage(`"2"`)}
+	scene, err := ParseScene(assets, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &compileJob{scene: scene}
+	for objectIndex, object := range scene.Objects {
+		job.objects = append(job.objects, sceneObjectInfo(objectIndex, object))
+	}
+	job.initReport()
+
+	expected := []ReportObject{
+		{Index: 0, ID: 1, Name: "", Type: "empty", Status: ReportConverted},
+		{Index: -1, ID: 2, Name: "rain", Type: "empty", Status: ReportSkipped, Reason: "hidden by user property rain"},
+		{Index: -1, ID: 4, Name: "clouds", Type: "empty", Status: ReportSkipped,
+			Reason: "hidden by user property weather"},
+		{Index: -1, ID: 3, Name: "", Type: "empty", Status: ReportSkipped, Reason: "parent object 2 is hidden"},
+	}
+	if !reflect.DeepEqual(job.report.Objects, expected) {
+		t.Errorf("report objects = %+v, want %+v", job.report.Objects, expected)
+	}
+}
@@ -0,0 +1,16 @@
+package compiler
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOpenwallpaperHeaderIsCurrent(t *testing.T) {
+	header, err := os.ReadFile("module/openwallpaper.h")
+	if err != nil {
+		t.Skipf("openwallpaper.h is not available: %v", err)
+	}
+	if string(header) != openwallpaperHeader {
+		t.Error("owapi.go is older than openwallpaper.h, run go generate")
+	}
+}
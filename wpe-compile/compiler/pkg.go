@@ -0,0 +1,382 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Wallpaper Engine bumps the version in the magic, but every known version has the same layout: the entry count,
+// then path, offset and length of every entry, then the data. Other versions are read with the same layout and a
+// warning, their index is checked harder since a misread layout shows up as entries that do not fit together.
+const (
+	pkgMagicPrefix        = "PKGV"
+	pkgMinEntryHeaderSize = 12
+)
+
+// pkgKnownVersions are the pkg versions seen in workshop scenes.
+var pkgKnownVersions = []int{1, 2, 5, 7, 8, 9, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22}
+
+type PkgEntry struct {
+	Path   string
+	Offset int64
+	Length int64
+}
+
+type PkgReader struct {
+	label   string
+	version int
+	file    *os.File
+	reader  io.ReaderAt
+	entries []PkgEntry
+	index   map[string]int
+}
+
+func OpenPkg(path string, label string) (*PkgReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	version, entries, err := readPkgIndex(file, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	pkg := &PkgReader{
+		label:   label,
+		version: version,
+		file:    file,
+		reader:  file,
+		entries: entries,
+		index:   make(map[string]int, len(entries)),
+	}
+	for idx, entry := range entries {
+		pkg.index[entry.Path] = idx
+	}
+	return pkg, nil
+}
+
+func readPkgIndex(ra io.ReaderAt, size int64) (int, []PkgEntry, error) {
+	r := &countingReader{r: bufio.NewReader(io.NewSectionReader(ra, 0, size))}
+
+	version, err := readPkgVersion(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	entries, err := readPkgEntries(r, size, slices.Contains(pkgKnownVersions, version))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", PkgMagic(version), err)
+	}
+	return version, entries, nil
+}
+
+func readPkgEntries(r *countingReader, size int64, knownVersion bool) ([]PkgEntry, error) {
+	entryCount, err := readInt32(r)
+	if err != nil {
+		return nil, fmt.Errorf("read entry count: %w", pkgReadError(err))
+	}
+	if entryCount < 0 {
+		return nil, fmt.Errorf("negative entry count: %d", entryCount)
+	}
+	if int64(entryCount)*pkgMinEntryHeaderSize > size {
+		return nil, fmt.Errorf("entry count %d does not fit in %d byte file, pkg is truncated or corrupt", entryCount, size)
+	}
+
+	entries := []PkgEntry{}
+	for i := 0; i < int(entryCount); i++ {
+		path, err := readStringI32(r, 255)
+		if err != nil {
+			return nil, fmt.Errorf("read entry[%d] path: %w", i, pkgReadError(err))
+		}
+		off, err := readInt32(r)
+		if err != nil {
+			return nil, fmt.Errorf("read entry[%d] offset: %w", i, pkgReadError(err))
+		}
+		ln, err := readInt32(r)
+		if err != nil {
+			return nil, fmt.Errorf("read entry[%d] length: %w", i, pkgReadError(err))
+		}
+		if off < 0 || ln < 0 {
+			return nil, fmt.Errorf("invalid header for entry[%d]: offset=%d length=%d", i, off, ln)
+		}
+		entries = append(entries, PkgEntry{Path: path, Offset: int64(off), Length: int64(ln)})
+	}
+
+	dataStart := r.n
+	for idx := range entries {
+		entry := &entries[idx]
+		start := dataStart + entry.Offset
+		end := start + entry.Length
+		if end > size {
+			return nil, fmt.Errorf("data of %q ends at %d, past the end of %d byte file, pkg is truncated or corrupt",
+				entry.Path, end, size)
+		}
+		entry.Offset = start
+	}
+
+	if knownVersion {
+		return entries, nil
+	}
+	// Wallpaper Engine stores entries one after another, so in a pkg of an unknown version overlapping data means the
+	// index was not read the way it was written. Known versions are not checked, other tools may share data.
+	sorted := slices.Clone(entries)
+	slices.SortFunc(sorted, func(a, b PkgEntry) int { return cmp.Compare(a.Offset, b.Offset) })
+	for idx := 1; idx < len(sorted); idx++ {
+		previous := sorted[idx-1]
+		if sorted[idx].Offset < previous.Offset+previous.Length {
+			return nil, fmt.Errorf("data of %q and %q overlap, pkg layout of this version is not supported or pkg is corrupt",
+				previous.Path, sorted[idx].Path)
+		}
+	}
+	return entries, nil
+}
+
+func readPkgVersion(r io.Reader) (int, error) {
+	magicLength, err := readInt32(r)
+	if err != nil {
+		return 0, fmt.Errorf("read magic: %w", pkgReadError(err))
+	}
+	if magicLength != int32(len(pkgMagicPrefix)+4) {
+		return 0, errors.New("not a Wallpaper Engine pkg file")
+	}
+	magicBytes := make([]byte, magicLength)
+	if _, err := io.ReadFull(r, magicBytes); err != nil {
+		return 0, fmt.Errorf("read magic: %w", pkgReadError(err))
+	}
+	return parsePkgVersion(string(magicBytes))
+}
+
+func parsePkgVersion(magic string) (int, error) {
+	digits, ok := strings.CutPrefix(magic, pkgMagicPrefix)
+	if !ok {
+		return 0, fmt.Errorf("not a Wallpaper Engine pkg file (magic %q)", magic)
+	}
+	version, err := strconv.Atoi(digits)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid pkg version %q", magic)
+	}
+	return version, nil
+}
+
+func unknownPkgVersion(version int) string {
+	return fmt.Sprintf("unknown pkg version %s, known versions are %s to %s", PkgMagic(version),
+		PkgMagic(slices.Min(pkgKnownVersions)), PkgMagic(slices.Max(pkgKnownVersions)))
+}
+
+func PkgMagic(version int) string {
+	return fmt.Sprintf("%s%04d", pkgMagicPrefix, version)
+}
+
+func pkgReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.New("pkg file is truncated")
+	}
+	return err
+}
+
+func (pkg *PkgReader) name() string {
+	return pkg.label
+}
+
+func (pkg *PkgReader) readFile(path string) ([]byte, error) {
+	idx, exists := pkg.index[path]
+	if !exists {
+		return nil, fs.ErrNotExist
+	}
+	entry := pkg.entries[idx]
+	data := make([]byte, entry.Length)
+	if _, err := pkg.reader.ReadAt(data, entry.Offset); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+func (pkg *PkgReader) hasFile(path string) bool {
+	_, exists := pkg.index[path]
+	return exists
+}
+
+func (pkg *PkgReader) ExtractEntry(entry PkgEntry, outputDir string) error {
+	rel := strings.TrimPrefix(entry.Path, "/")
+	if !fs.ValidPath(rel) {
+		return fmt.Errorf("refusing to extract unsafe path %q", entry.Path)
+	}
+	outputPath := filepath.Join(outputDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, io.NewSectionReader(pkg.reader, entry.Offset, entry.Length)); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (pkg *PkgReader) Version() int {
+	return pkg.version
+}
+
+// Warning returns why the pkg may have been misread, or "" if its version is known.
+func (pkg *PkgReader) Warning() string {
+	if slices.Contains(pkgKnownVersions, pkg.version) {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s, read with the layout of the known versions", pkg.label, unknownPkgVersion(pkg.version))
+}
+
+func (pkg *PkgReader) Entries() []PkgEntry {
+	return pkg.entries
+}
+
+func (pkg *PkgReader) Close() error {
+	return pkg.file.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	reader.n += int64(n)
+	return n, err
+}
+
+func readInt32(r io.Reader) (int32, error) {
+	var v int32
+	if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func readStringI32(r io.Reader, max int) (string, error) {
+	n, err := readInt32(r)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 {
+		return "", fmt.Errorf("negative string length: %d", n)
+	}
+	if max > 0 && int(n) > max {
+		return "", fmt.Errorf("string length %d exceeds limit %d", n, max)
+	}
+	b := make([]byte, int(n))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func WritePkg(w io.Writer, root string, version int) error {
+	if !slices.Contains(pkgKnownVersions, version) {
+		return fmt.Errorf("cannot write %s", unknownPkgVersion(version))
+	}
+
+	type packedFile struct {
+		path     string
+		fullPath string
+		size     int64
+	}
+
+	files := []packedFile{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if len(rel) > 255 {
+			return fmt.Errorf("path %s is longer than 255 bytes", rel)
+		}
+		files = append(files, packedFile{path: rel, fullPath: path, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(files, func(a, b packedFile) int {
+		return strings.Compare(a.path, b.path)
+	})
+
+	header := new(bytes.Buffer)
+	writeStringI32(header, PkgMagic(version))
+	writeInt32(header, int32(len(files)))
+	offset := int64(0)
+	for _, file := range files {
+		if offset+file.size > math.MaxInt32 {
+			return fmt.Errorf("pkg data exceeds %d bytes at %s", math.MaxInt32, file.path)
+		}
+		writeStringI32(header, file.path)
+		writeInt32(header, int32(offset))
+		writeInt32(header, int32(file.size))
+		offset += file.size
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := copyFileTo(w, file.fullPath, file.size); err != nil {
+			return fmt.Errorf("write %s: %w", file.path, err)
+		}
+	}
+	return nil
+}
+
+func copyFileTo(w io.Writer, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	written, err := io.Copy(w, io.LimitReader(file, size))
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("file changed size while packing")
+	}
+	return nil
+}
+
+func writeInt32(w *bytes.Buffer, v int32) {
+	_ = binary.Write(w, binary.LittleEndian, v)
+}
+
+func writeStringI32(w *bytes.Buffer, s string) {
+	writeInt32(w, int32(len(s)))
+	w.WriteString(s)
+}
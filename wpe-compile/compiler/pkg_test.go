@@ -0,0 +1,207 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testPkgEntry struct {
+	path string
+	data string
+}
+
+// buildTestPkg lays out a pkg the way Wallpaper Engine writes it. extraField inserts one more int32 after every
+// entry header to stand in for a layout change.
+func buildTestPkg(magic string, entries []testPkgEntry, extraField bool) []byte {
+	header := &bytes.Buffer{}
+	writeStringI32(header, magic)
+	writeInt32(header, int32(len(entries)))
+	offset := 0
+	for _, entry := range entries {
+		writeStringI32(header, entry.path)
+		writeInt32(header, int32(offset))
+		writeInt32(header, int32(len(entry.data)))
+		if extraField {
+			writeInt32(header, 0x7fffffff)
+		}
+		offset += len(entry.data)
+	}
+	for _, entry := range entries {
+		header.WriteString(entry.data)
+	}
+	return header.Bytes()
+}
+
+func TestReadPkgIndex(t *testing.T) {
+	entries := []testPkgEntry{{"scene.json", `{"objects":[]}`}, {"materials/a.tex", "TEXV0005"}, {"empty", ""}}
+	overlapping := buildTestPkg("PKGV0042", entries[:2], false)
+	// Point the second entry at the start of the data, on top of the first one.
+	overlapOffset := 4 + 8 + 4 + 4 + len("scene.json") + 8 + 4 + len("materials/a.tex")
+	binary.LittleEndian.PutUint32(overlapping[overlapOffset:], 0)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		version int
+		entries []testPkgEntry
+		err     string
+	}{
+		{"version 1", buildTestPkg("PKGV0001", entries, false), 1, entries, ""},
+		{"version 9", buildTestPkg("PKGV0009", entries, false), 9, entries, ""},
+		{"version 21", buildTestPkg("PKGV0021", entries, false), 21, entries, ""},
+		{"version 22", buildTestPkg("PKGV0022", entries, false), 22, entries, ""},
+		{"no entries", buildTestPkg("PKGV0001", nil, false), 1, nil, ""},
+		{"empty file", nil, 0, nil, "truncated"},
+		{"wrong magic length", buildTestPkg("PKGV01", entries, false), 0, nil, "not a Wallpaper Engine pkg file"},
+		{"wrong magic", buildTestPkg("ABCD0001", entries, false), 0, nil, "not a Wallpaper Engine pkg file"},
+		{"version 0", buildTestPkg("PKGV0000", entries, false), 0, nil, "invalid pkg version"},
+		{"non-numeric version", buildTestPkg("PKGVabcd", entries, false), 0, nil, "invalid pkg version"},
+		{"unknown version", buildTestPkg("PKGV0042", entries, false), 42, entries, ""},
+		{"truncated index", buildTestPkg("PKGV0001", entries, false)[:45], 0, nil, "PKGV0001: read entry[1]"},
+		{"truncated data", bytes.TrimSuffix(buildTestPkg("PKGV0001", entries, false), []byte("TEXV0005")), 0, nil,
+			"PKGV0001: data of \"materials/a.tex\" ends at"},
+		{"different layout", buildTestPkg("PKGV0021", entries, true), 0, nil, "PKGV0021: "},
+		{"unknown version overlapping data", overlapping, 0, nil, "PKGV0042: data of \"scene.json\" and \"materials/a.tex\" overlap"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, index, err := readPkgIndex(bytes.NewReader(test.data), int64(len(test.data)))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != test.version {
+				t.Errorf("version = %d, want %d", version, test.version)
+			}
+			expected := test.entries
+			if len(index) != len(expected) {
+				t.Fatalf("got %d entries, want %d", len(index), len(expected))
+			}
+			for idx, entry := range index {
+				data := test.data[entry.Offset : entry.Offset+entry.Length]
+				if entry.Path != expected[idx].path || string(data) != expected[idx].data {
+					t.Errorf("entry %d = %q %q, want %q %q", idx, entry.Path, data, expected[idx].path, expected[idx].data)
+				}
+			}
+		})
+	}
+}
+
+// TestReadPkgIndexKnownLayouts checks that pkgs of known versions the reader accepted before versions were checked
+// still load: entries sharing data, duplicate paths, data out of index order and bytes after the last entry.
+func TestReadPkgIndexKnownLayouts(t *testing.T) {
+	header := &bytes.Buffer{}
+	writeStringI32(header, "PKGV0009")
+	writeInt32(header, 4)
+	for _, entry := range []struct {
+		path           string
+		offset, length int32
+	}{{"b.json", 2, 2}, {"a.json", 0, 4}, {"copy.json", 0, 4}, {"a.json", 2, 2}} {
+		writeStringI32(header, entry.path)
+		writeInt32(header, entry.offset)
+		writeInt32(header, entry.length)
+	}
+	data := append(header.Bytes(), "{}[]trailing"...)
+
+	version, index, err := readPkgIndex(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 9 || len(index) != 4 {
+		t.Fatalf("read version %d with %d entries, want version 9 with 4", version, len(index))
+	}
+	pkg := &PkgReader{version: version, reader: bytes.NewReader(data), entries: index, index: map[string]int{}}
+	for idx, entry := range index {
+		pkg.index[entry.Path] = idx
+	}
+	for path, expected := range map[string]string{"a.json": "[]", "b.json": "[]", "copy.json": "{}[]"} {
+		if content, err := pkg.readFile(path); err != nil || string(content) != expected {
+			t.Errorf("%s = %q, %v, want %q", path, content, err, expected)
+		}
+	}
+	if warning := pkg.Warning(); warning != "" {
+		t.Errorf("unexpected warning %q", warning)
+	}
+}
+
+func TestPkgWarning(t *testing.T) {
+	pkgPath := filepath.Join(t.TempDir(), "scene.pkg")
+	data := buildTestPkg("PKGV0042", []testPkgEntry{{"scene.json", "{}"}}, false)
+	if err := os.WriteFile(pkgPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := OpenPkg(pkgPath, "scene.pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+	if warning := pkg.Warning(); !strings.Contains(warning, "scene.pkg: unknown pkg version PKGV0042") {
+		t.Errorf("warning = %q, want one naming PKGV0042", warning)
+	}
+}
+
+func TestWritePkgRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"scene.json":            `{"objects":[]}`,
+		"materials/a.json":      `{"passes":[]}`,
+		"materials/deep/b.tex":  "TEXV0005 data",
+		"shaders/effect.frag":   "void main() {}",
+		"models/empty_file.txt": "",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, version := range []int{1, 21} {
+		pkgPath := filepath.Join(t.TempDir(), "scene.pkg")
+		output := &bytes.Buffer{}
+		if err := WritePkg(output, root, version); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pkgPath, output.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		pkg, err := OpenPkg(pkgPath, "scene.pkg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Version() != version {
+			t.Errorf("version = %d, want %d", pkg.Version(), version)
+		}
+		if len(pkg.Entries()) != len(files) {
+			t.Errorf("got %d entries, want %d", len(pkg.Entries()), len(files))
+		}
+		for path, content := range files {
+			data, err := pkg.readFile(path)
+			if err != nil {
+				t.Errorf("read %s: %v", path, err)
+			} else if string(data) != content {
+				t.Errorf("%s = %q, want %q", path, data, content)
+			}
+		}
+		_ = pkg.Close()
+	}
+
+	for _, version := range []int{0, 42} {
+		if err := WritePkg(&bytes.Buffer{}, root, version); err == nil {
+			t.Errorf("writing version %d succeeded", version)
+		}
+	}
+}
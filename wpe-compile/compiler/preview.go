@@ -0,0 +1,163 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+
+	"github.com/chai2010/webp"
+)
+
+const (
+	previewDefaultWidth  = 1920
+	previewDefaultHeight = 1080
+)
+
+// composeScenePreview draws static image layers of the scene on the CPU using textures that were already imported.
+// Effects, puppets and particles are not rendered, so the result is only an approximation of the first frame.
+func (job *compileJob) composeScenePreview() ([]byte, error) {
+	width := job.scene.General.Ortho.Width
+	height := job.scene.General.Ortho.Height
+	if width <= 0 || height <= 0 {
+		width = previewDefaultWidth
+		height = previewDefaultHeight
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	if job.scene.General.ClearEnabled {
+		clearColor := job.scene.General.ClearColor
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.RGBA{
+			R: previewColorChannel(clearColor[0]),
+			G: previewColorChannel(clearColor[1]),
+			B: previewColorChannel(clearColor[2]),
+			A: 255,
+		}), image.Point{}, draw.Src)
+	}
+
+	objectsByID := map[int]SceneObject{}
+	for objectIndex, object := range job.scene.Objects {
+		objectsByID[sceneObjectInfo(objectIndex, object).ID] = object
+	}
+
+	layers := 0
+	for objectIndex, object := range job.scene.Objects {
+		if objectIndex >= len(job.scene.Types) || job.scene.Types[objectIndex] != 0 {
+			continue
+		}
+		imageObject, ok := object.(*ImageObject)
+		if !ok || !imageObject.Visible || imageObject.Puppet != nil || imageObject.CompositionLayer {
+			continue
+		}
+		if len(imageObject.Material.ImportedTextures) == 0 || imageObject.Alpha <= 0 {
+			continue
+		}
+		texture, err := job.previewTexture(imageObject.Material.ImportedTextures[0])
+		if err != nil {
+			continue
+		}
+
+		rect := canvas.Bounds()
+		if !imageObject.Fullscreen {
+			rect = previewObjectRect(imageObject, objectsByID, height)
+		}
+		options := &xdraw.Options{}
+		if imageObject.Alpha < 1 {
+			options.DstMask = image.NewUniform(color.Alpha{A: previewColorChannel(imageObject.Alpha)})
+		}
+		xdraw.ApproxBiLinear.Scale(canvas, rect, texture, texture.Bounds(), xdraw.Over, options)
+		layers++
+	}
+	if layers == 0 {
+		return nil, errors.New("cannot generate preview, scene has no static image layers")
+	}
+
+	preview, err := fitPreviewImage(canvas)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := webp.Encode(&buffer, preview, &webp.Options{Lossless: false, Quality: previewQuality}); err != nil {
+		return nil, fmt.Errorf("encode preview webp failed: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func (job *compileJob) previewTexture(taskID int) (image.Image, error) {
+	if taskID < 0 || taskID >= len(job.tasks) {
+		return nil, errors.New("texture was not imported")
+	}
+	task, ok := job.tasks[taskID].(*ImportTextureTask)
+	if !ok || task.Error != nil {
+		return nil, errors.New("texture was not imported")
+	}
+	data, err := job.archive.read(fmt.Sprintf("textures/%d.webp", task.ID))
+	if err != nil {
+		return nil, errors.New("texture was not imported")
+	}
+	texture, err := webp.DecodeRGBA(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.SpritesheetCols > 1 || task.SpritesheetRows > 1 {
+		bounds := texture.Bounds()
+		frameWidth := bounds.Dx() / max(task.SpritesheetCols, 1)
+		frameHeight := bounds.Dy() / max(task.SpritesheetRows, 1)
+		return texture.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+frameWidth, bounds.Min.Y+frameHeight)), nil
+	}
+	return texture, nil
+}
+
+// previewObjectRect returns the object rectangle in canvas pixels. Scene coordinates have Y pointing up, parent
+// rotation is ignored.
+func previewObjectRect(object *ImageObject, objectsByID map[int]SceneObject, canvasHeight int) image.Rectangle {
+	origin := object.Origin
+	scale := object.Scale
+	visited := map[int]bool{object.ID: true}
+	for parentID := object.Parent; parentID >= 0 && !visited[parentID]; {
+		visited[parentID] = true
+		parentOrigin, parentScale, nextParent, ok := sceneObjectTransform(objectsByID[parentID])
+		if !ok {
+			break
+		}
+		for axis := range 3 {
+			origin[axis] = parentOrigin[axis] + origin[axis]*parentScale[axis]
+			scale[axis] *= parentScale[axis]
+		}
+		parentID = nextParent
+	}
+
+	halfWidth := float64(object.Size[0]*scale[0]) / 2
+	halfHeight := float64(object.Size[1]*scale[1]) / 2
+	centerX := float64(origin[0])
+	centerY := float64(canvasHeight) - float64(origin[1])
+	return image.Rect(
+		int(math.Round(centerX-math.Abs(halfWidth))),
+		int(math.Round(centerY-math.Abs(halfHeight))),
+		int(math.Round(centerX+math.Abs(halfWidth))),
+		int(math.Round(centerY+math.Abs(halfHeight))),
+	)
+}
+
+func sceneObjectTransform(object SceneObject) (Vector3, Vector3, int, bool) {
+	switch object := object.(type) {
+	case *ImageObject:
+		return object.Origin, object.Scale, object.Parent, true
+	case *ParticleObject:
+		return object.Origin, object.Scale, object.Parent, true
+	case *EmptyObject:
+		return object.Origin, object.Scale, object.Parent, true
+	default:
+		return Vector3{}, Vector3{}, -1, false
+	}
+}
+
+func previewColorChannel(value float32) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, float64(value))) * 255))
+}
@@ -0,0 +1,160 @@
+package compiler
+
+import (
+	"errors"
+	"maps"
+	"strings"
+)
+
+type ReportStatus string
+
+const (
+	ReportConverted ReportStatus = "converted"
+	ReportSkipped   ReportStatus = "skipped"
+	ReportFailed    ReportStatus = "failed"
+)
+
+// Report lists every object, effect, shader and texture of the scene and whether it made it into the output.
+// Skipped parts were left out on purpose or are unsupported, failed parts broke during conversion.
+type Report struct {
+	Objects  []ReportObject  `json:"objects"`
+	Effects  []ReportEffect  `json:"effects"`
+	Shaders  []ReportShader  `json:"shaders"`
+	Textures []ReportTexture `json:"textures"`
+}
+
+type ReportObject struct {
+	Index  int          `json:"index"`
+	ID     int          `json:"id"`
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Status ReportStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+type ReportEffect struct {
+	Object int          `json:"object"`
+	Index  int          `json:"index"`
+	Name   string       `json:"name"`
+	Status ReportStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+type ReportShader struct {
+	Name    string         `json:"name"`
+	Defines map[string]int `json:"defines,omitempty"`
+	Status  ReportStatus   `json:"status"`
+	Reason  string         `json:"reason,omitempty"`
+	Log     string         `json:"log,omitempty"`
+}
+
+type ReportTexture struct {
+	Name   string       `json:"name"`
+	Status ReportStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+func (job *compileJob) initReport() {
+	job.objectIndexes = map[SceneObject]int{}
+	job.report = Report{
+		Objects:  []ReportObject{},
+		Effects:  []ReportEffect{},
+		Shaders:  []ReportShader{},
+		Textures: []ReportTexture{},
+	}
+	for objectIndex, object := range job.scene.Objects {
+		info := job.objects[objectIndex]
+		job.objectIndexes[object] = objectIndex
+		job.report.Objects = append(job.report.Objects, ReportObject{
+			Index:  info.Index,
+			ID:     info.ID,
+			Name:   info.Name,
+			Type:   info.Type,
+			Status: ReportConverted,
+		})
+
+		imageObject, ok := object.(*ImageObject)
+		if !ok {
+			continue
+		}
+		for effectIndex := range imageObject.Effects {
+			job.addReportEffect(objectIndex, &imageObject.Effects[effectIndex])
+		}
+	}
+	// Hidden objects are not in the scene, so they have no index and come after the objects that are.
+	for _, hidden := range job.scene.Hidden {
+		job.report.Objects = append(job.report.Objects, ReportObject{
+			Index:  -1,
+			ID:     hidden.ID,
+			Name:   hidden.Name,
+			Type:   hidden.Type,
+			Status: ReportSkipped,
+			Reason: hidden.Reason,
+		})
+	}
+}
+
+func (job *compileJob) addReportEffect(objectIndex int, effect *ImageEffect) {
+	effectIndex := 0
+	for _, reported := range job.report.Effects {
+		if reported.Object == objectIndex {
+			effectIndex++
+		}
+	}
+	effect.reportIndex = len(job.report.Effects)
+	job.report.Effects = append(job.report.Effects, ReportEffect{
+		Object: objectIndex,
+		Index:  effectIndex,
+		Name:   effectDisplayName(*effect),
+		Status: ReportConverted,
+	})
+}
+
+func (job *compileJob) reportObject(object SceneObject, status ReportStatus, reason string) {
+	if objectIndex, ok := job.objectIndexes[object]; ok {
+		job.report.Objects[objectIndex].Status = status
+		job.report.Objects[objectIndex].Reason = reason
+	}
+}
+
+func (job *compileJob) reportEffect(effect *ImageEffect, status ReportStatus, reason string) {
+	job.report.Effects[effect.reportIndex].Status = status
+	job.report.Effects[effect.reportIndex].Reason = reason
+}
+
+// finishReport adds shader and texture tasks and marks effects of dropped objects with the status of their object.
+func (job *compileJob) finishReport() {
+	for effectIndex := range job.report.Effects {
+		effect := &job.report.Effects[effectIndex]
+		object := job.report.Objects[effect.Object]
+		if effect.Status == ReportConverted && object.Status != ReportConverted {
+			effect.Status = object.Status
+			effect.Reason = "object was not converted"
+		}
+	}
+
+	for _, anyTask := range job.tasks {
+		switch task := anyTask.(type) {
+		case *ImportTextureTask:
+			texture := ReportTexture{Name: task.Name, Status: ReportConverted}
+			if task.Error != nil {
+				texture.Status = ReportFailed
+				texture.Reason = task.Error.Error()
+			}
+			job.report.Textures = append(job.report.Textures, texture)
+		case *CompileShaderTask:
+			shader := ReportShader{Name: task.Name, Defines: maps.Clone(task.Defines), Status: ReportConverted}
+			if task.Error != nil {
+				shader.Status = ReportFailed
+				shader.Reason = task.Error.Error()
+				var glslcErr *GLSLCError
+				if errors.As(task.Error, &glslcErr) {
+					reason, _, _ := strings.Cut(shader.Reason, "\n")
+					shader.Reason = strings.TrimSuffix(reason, ":")
+					shader.Log = glslcErr.Log
+				}
+			}
+			job.report.Shaders = append(job.report.Shaders, shader)
+		}
+	}
+}
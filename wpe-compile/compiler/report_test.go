@@ -0,0 +1,37 @@
+package compiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportFailedTexture(t *testing.T) {
+	projectDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(projectDir, "scene.json"), []byte(`{"objects":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assets, err := OpenAssets(projectDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+
+	job := &compileJob{ctx: context.Background(), assets: assets, tasks: []any{&ImportTextureTask{Name: "missing"}}}
+	job.initReport()
+	if err := job.executeTasksFrom(0); err != nil {
+		t.Fatal(err)
+	}
+	job.collectSceneTaskResults()
+	job.finishReport()
+
+	if len(job.warnings) != 1 || !strings.Contains(job.warnings[0], "skipping texture missing") {
+		t.Errorf("warnings = %v, want one about skipping the texture", job.warnings)
+	}
+	textures := job.report.Textures
+	if len(textures) != 1 || textures[0].Status != ReportFailed || textures[0].Reason == "" {
+		t.Errorf("report textures = %+v, want missing as failed with its cause", textures)
+	}
+}
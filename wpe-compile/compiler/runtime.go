@@ -0,0 +1,213 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type runtimeSource struct {
+	name string
+	code []byte
+}
+
+// runtimeSources are the embedded C files of the scene module. None of them depend on the scene, scene_data.c
+// loads it from the archive when the module starts.
+func runtimeSources() []runtimeSource {
+	return []runtimeSource{
+		{"main.c", mainCode},
+		{"renderer.c", rendererCode},
+		{"common.c", commonCode},
+		{"uniform.c", uniformCode},
+		{"image.c", imageCode},
+		{"puppet.c", puppetCode},
+		{"particle.c", particleCode},
+		{"transform.c", transformCode},
+		{"scene_data.c", sceneDataCode},
+	}
+}
+
+var moduleCompileFlags = []string{"-DSCENE", "-O3"}
+
+// moduleStackSize is the stack of the scene module. It is placed in memory by the linker, so unlike the memory
+// maximum it cannot be set per scene without linking again. The runtime only recurses in object_global_transform in
+// transform.c, one frame per parent, so the stack a scene needs grows with the depth of its object hierarchy and not
+// with its size. 1 MiB covers hierarchies far deeper than Wallpaper Engine scenes have, checkModuleStack warns about
+// deeper ones.
+const moduleStackSize = 1024 * 1024
+
+// moduleLinkFlags do not set a memory maximum, Compile sets it for every scene in limitModuleMemory.
+var moduleLinkFlags = []string{
+	"-Wl,--allow-undefined",
+	"-Wl,-z,stack-size=" + strconv.Itoa(moduleStackSize),
+	"-Wl,--export=malloc",
+	"-Wl,--export=free",
+	"-Wl,--export=__heap_base",
+	"-Wl,--export=__data_end",
+}
+
+// BuildModule compiles the scene module with options.WasmCC. The module is the same for every scene, so it can
+// be built once and passed to Compile as options.Module. Only WasmCC, CacheDir and TaskTimeout are used.
+func BuildModule(ctx context.Context, options Options) ([]byte, error) {
+	if options.WasmCC == "" {
+		return nil, NewError(ToolchainError, ErrNoWasmCC)
+	}
+	job := &compileJob{
+		ctx:     ctx,
+		options: options,
+		cache:   openBuildCache(options.CacheDir),
+	}
+	return job.sceneModule()
+}
+
+// sceneModule returns options.Module if it is set, or the module built with options.WasmCC otherwise. Either
+// way the module is checked against openwallpaper.h, so that a broken module fails the build instead of failing
+// in wallpaperd.
+func (job *compileJob) sceneModule() ([]byte, error) {
+	if job.options.Module != "" {
+		moduleBytes, err := os.ReadFile(job.options.Module)
+		if err != nil {
+			return nil, NewError(InputError, fmt.Errorf("open scene module failed: %w", err))
+		}
+		if err := validateModule(moduleBytes); err != nil {
+			return nil, NewError(InputError, fmt.Errorf("scene module %s is not usable: %w", job.options.Module, err))
+		}
+		return moduleBytes, nil
+	}
+
+	moduleBytes, err := job.buildModule()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateModule(moduleBytes); err != nil {
+		return nil, NewError(CompileError, fmt.Errorf("built scene module is not usable: %w", err))
+	}
+	return moduleBytes, nil
+}
+
+// buildModule compiles the scene module once per compiler version, runtime sources, openwallpaper.h and WASM C
+// compiler and keeps it in the cache.
+func (job *compileJob) buildModule() ([]byte, error) {
+	ctx, cancel := job.taskContext()
+	ccVersion, err := runTool(ctx, job.options.WasmCC, "--version")
+	cancel()
+	if err != nil {
+		return nil, NewError(ToolchainError, fmt.Errorf("WASM C compiler is not usable: %w", err))
+	}
+
+	keyParts := [][]byte{
+		[]byte(job.options.WasmCC), ccVersion, defsCode, []byte(openwallpaperHeader),
+		[]byte(strings.Join(moduleCompileFlags, " ")), []byte(strings.Join(moduleLinkFlags, " ")),
+	}
+	for _, source := range runtimeSources() {
+		keyParts = append(keyParts, []byte(source.name), source.code)
+	}
+	cacheKey := job.cache.key("module", keyParts...)
+
+	if moduleDir, ok := job.cache.loadDir("module", cacheKey); ok {
+		if moduleBytes, err := readModule(moduleDir); err == nil {
+			return moduleBytes, nil
+		}
+	}
+
+	job.progress(len(job.tasks), len(job.tasks), "compiling scene module")
+	if job.cache != nil {
+		moduleDir, err := job.cache.storeDir("module", cacheKey, job.compileModule)
+		var compileErr *Error
+		if errors.As(err, &compileErr) {
+			return nil, err
+		}
+		if err == nil {
+			return readModule(moduleDir)
+		}
+		job.warnf("caching scene module failed: %s", err)
+	}
+
+	moduleDir, err := os.MkdirTemp("", "wpe-compile-")
+	if err != nil {
+		return nil, NewError(CompileError, fmt.Errorf("creating temp dir failed: %w", err))
+	}
+	defer func() {
+		if err := os.RemoveAll(moduleDir); err != nil {
+			job.warnf("failed to remove temp dir: %s", err)
+		}
+	}()
+	if err := job.compileModule(moduleDir); err != nil {
+		return nil, err
+	}
+	return readModule(moduleDir)
+}
+
+func readModule(dir string) ([]byte, error) {
+	moduleBytes, err := os.ReadFile(filepath.Join(dir, "scene.wasm"))
+	if err != nil {
+		return nil, NewError(CompileError, fmt.Errorf("reading scene module failed: %w", err))
+	}
+	return moduleBytes, nil
+}
+
+// compileModule compiles every runtime source into an object file in dir in parallel, then links them into
+// dir/scene.wasm. The headers are written next to the sources, so nothing is included from the working directory.
+func (job *compileJob) compileModule(dir string) error {
+	files := map[string][]byte{"defs.h": defsCode, "openwallpaper.h": []byte(openwallpaperHeader)}
+	for _, source := range runtimeSources() {
+		files[source.name] = source.code
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return NewError(CompileError, fmt.Errorf("write %s failed: %w", name, err))
+		}
+	}
+
+	sources := runtimeSources()
+	objects := make([]string, len(sources))
+	logs := make([][]byte, len(sources))
+	errs := make([]error, len(sources))
+	wg := sync.WaitGroup{}
+	for sourceIdx, source := range sources {
+		sourcePath := filepath.Join(dir, source.name)
+		objects[sourceIdx] = strings.TrimSuffix(sourcePath, ".c") + ".o"
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := job.taskContext()
+			defer cancel()
+			compileArgs := append([]string{sourcePath, "-c", "-o", objects[sourceIdx]}, moduleCompileFlags...)
+			compileArgs = append(compileArgs, "-ffile-prefix-map="+dir+"=.")
+			logs[sourceIdx], errs[sourceIdx] = runTool(ctx, job.options.WasmCC, compileArgs...)
+		}()
+	}
+	wg.Wait()
+
+	if job.ctx.Err() != nil {
+		return NewError(CanceledError, fmt.Errorf("compilation canceled: %w", job.ctx.Err()))
+	}
+	for sourceIdx, err := range errs {
+		if err != nil {
+			compileErr := NewError(CompileError, fmt.Errorf("compiling runtime %s failed: %w", sources[sourceIdx].name, err))
+			compileErr.Log = string(bytes.Join(logs, nil))
+			return compileErr
+		}
+	}
+
+	linkArgs := append(objects, "-o", filepath.Join(dir, "scene.wasm"))
+	linkArgs = append(linkArgs, moduleLinkFlags...)
+	ctx, cancel := job.taskContext()
+	defer cancel()
+	logBytes, err := runTool(ctx, job.options.WasmCC, linkArgs...)
+	if job.ctx.Err() != nil {
+		return NewError(CanceledError, fmt.Errorf("compilation canceled: %w", job.ctx.Err()))
+	}
+	if err != nil {
+		compileErr := NewError(CompileError, fmt.Errorf("linking scene module failed: %w", err))
+		compileErr.Log = string(logBytes)
+		return compileErr
+	}
+	return nil
+}
@@ -1,13 +1,13 @@
-package main
+package compiler
 
 import (
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"maps"
 	"math"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -131,6 +131,105 @@ func unwrapJSONValue(raw json.RawMessage) json.RawMessage {
 	return raw
 }
 
+type UserField int
+
+const (
+	UserFieldVisible UserField = iota
+	UserFieldAlpha
+	UserFieldColor
+	UserFieldBrightness
+)
+
+func (field UserField) String() string {
+	switch field {
+	case UserFieldAlpha:
+		return "USER_FIELD_ALPHA"
+	case UserFieldColor:
+		return "USER_FIELD_COLOR"
+	case UserFieldBrightness:
+		return "USER_FIELD_BRIGHTNESS"
+	default:
+		return "USER_FIELD_VISIBLE"
+	}
+}
+
+type UserBinding struct {
+	Field        UserField
+	Property     string
+	Condition    string
+	HasCondition bool
+}
+
+type userFieldKey struct {
+	Key   string
+	Field UserField
+}
+
+var (
+	objectUserFields = []userFieldKey{{"visible", UserFieldVisible}}
+	imageUserFields  = []userFieldKey{
+		{"visible", UserFieldVisible},
+		{"alpha", UserFieldAlpha},
+		{"color", UserFieldColor},
+		{"brightness", UserFieldBrightness},
+	}
+)
+
+func parseUserBinding(raw json.RawMessage, field UserField) (UserBinding, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return UserBinding{}, false
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &object); err != nil {
+		return UserBinding{}, false
+	}
+	user, exists := object["user"]
+	if !exists {
+		return UserBinding{}, false
+	}
+
+	binding := UserBinding{Field: field}
+	if err := json.Unmarshal(user, &binding.Property); err == nil {
+		return binding, binding.Property != ""
+	}
+	var userObject struct {
+		Name      string          `json:"name"`
+		Condition json.RawMessage `json:"condition"`
+	}
+	if err := json.Unmarshal(user, &userObject); err != nil || userObject.Name == "" {
+		return UserBinding{}, false
+	}
+	binding.Property = userObject.Name
+	if bytesFromRawNullAware(userObject.Condition) != nil {
+		binding.Condition = rawOptionValue(userObject.Condition)
+		binding.HasCondition = true
+	}
+	return binding, true
+}
+
+func parseUserBindings(raw json.RawMessage, fields []userFieldKey) []UserBinding {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil
+	}
+	var bindings []UserBinding
+	for _, field := range fields {
+		if binding, ok := parseUserBinding(object[field.Key], field.Field); ok {
+			bindings = append(bindings, binding)
+		}
+	}
+	return bindings
+}
+
+func rawOptionValue(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(bytes.TrimSpace(raw))
+}
+
 func parseStringFromRaw(raw json.RawMessage) (string, error) {
 	if bytesFromRawNullAware(raw) == nil {
 		return "", nil
@@ -285,24 +384,18 @@ func parseVector3FromRaw(raw json.RawMessage, defaultValue Vector3) (Vector3, er
 	return defaultValue, fmt.Errorf("expected 3 components, got %d", len(values))
 }
 
-func loadBytesFromPackage(pkgMap *map[string][]byte, path string) ([]byte, error) {
-	if pkgMap == nil {
-		return nil, errors.New("package map pointer is nil")
-	}
-	if data, exists := (*pkgMap)[path]; exists {
-		return data, nil
-	}
-	if data, exists := (*pkgMap)["/assets/"+path]; exists {
-		return data, nil
+func loadBytesFromPackage(assets *AssetFS, path string) ([]byte, error) {
+	if assets == nil {
+		return nil, errors.New("asset filesystem is nil")
 	}
-	if data, exists := (*pkgMap)["assets/"+path]; exists {
-		return data, nil
+	data, err := assets.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("file %s not found", path)
 	}
-	data, err := os.ReadFile(env.Assets + "/" + path)
-	if err == nil {
-		return data, nil
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %w", path, err)
 	}
-	return nil, fmt.Errorf("file %s not found", path)
+	return data, nil
 }
 
 type MaterialPassBindItem struct {
@@ -508,12 +601,15 @@ type EffectFBO struct {
 }
 
 type ImageEffect struct {
-	Name      string
-	Path      string
-	Visible   bool
-	Passes    []MaterialPass
-	FBOs      []EffectFBO
-	Materials []Material
+	Name         string
+	Path         string
+	Visible      bool
+	UserBindings []UserBinding
+	Passes       []MaterialPass
+	FBOs         []EffectFBO
+	Materials    []Material
+
+	reportIndex int
 }
 
 func (fbo *EffectFBO) parseFromJSON(raw json.RawMessage) error {
@@ -535,7 +631,7 @@ func (fbo *EffectFBO) parseFromJSON(raw json.RawMessage) error {
 	return nil
 }
 
-func (effect *ImageEffect) parseFromFileJSON(raw json.RawMessage, pkgMap *map[string][]byte) error {
+func (effect *ImageEffect) parseFromFileJSON(raw json.RawMessage, assets *AssetFS) error {
 	payload := struct {
 		Name   StringValue       `json:"name"`
 		FBOs   []json.RawMessage `json:"fbos"`
@@ -583,7 +679,7 @@ func (effect *ImageEffect) parseFromFileJSON(raw json.RawMessage, pkgMap *map[st
 		}
 
 		materialPath := string(passProbe.Material)
-		materialBytes, err := loadBytesFromPackage(pkgMap, materialPath)
+		materialBytes, err := loadBytesFromPackage(assets, materialPath)
 		if err != nil {
 			return fmt.Errorf("cannot load material file %s: %w", materialPath, err)
 		}
@@ -631,7 +727,7 @@ func (effect *ImageEffect) parseFromFileJSON(raw json.RawMessage, pkgMap *map[st
 	return nil
 }
 
-func (effect *ImageEffect) parseFromSceneJSON(raw json.RawMessage, pkgMap *map[string][]byte) error {
+func (effect *ImageEffect) parseFromSceneJSON(raw json.RawMessage, assets *AssetFS) error {
 	payload := struct {
 		File    StringValue       `json:"file"`
 		Name    StringValue       `json:"name"`
@@ -650,11 +746,11 @@ func (effect *ImageEffect) parseFromSceneJSON(raw json.RawMessage, pkgMap *map[s
 	effectPath := string(payload.File)
 	effect.Path = effectPath
 
-	effectBytes, err := loadBytesFromPackage(pkgMap, effectPath)
+	effectBytes, err := loadBytesFromPackage(assets, effectPath)
 	if err != nil {
 		return fmt.Errorf("cannot load effect file %s: %w", effectPath, err)
 	}
-	if err := effect.parseFromFileJSON(effectBytes, pkgMap); err != nil {
+	if err := effect.parseFromFileJSON(effectBytes, assets); err != nil {
 		return err
 	}
 
@@ -662,6 +758,7 @@ func (effect *ImageEffect) parseFromSceneJSON(raw json.RawMessage, pkgMap *map[s
 		effect.Name = string(payload.Name)
 	}
 	effect.Visible = bool(payload.Visible)
+	effect.UserBindings = parseUserBindings(raw, objectUserFields)
 
 	for index, passOverrideRaw := range payload.Passes {
 		if index >= len(effect.Passes) {
@@ -721,9 +818,10 @@ type ImageObject struct {
 	Puppet           *PuppetMetadata
 	PuppetData       []byte
 	PuppetLayers     []PuppetAnimationLayer
+	UserBindings     []UserBinding
 }
 
-func (imageObject *ImageObject) parseFromSceneJSON(raw json.RawMessage, pkgMap *map[string][]byte) error {
+func (imageObject *ImageObject) parseFromSceneJSON(raw json.RawMessage, assets *AssetFS) error {
 	type layerJSON struct {
 		Animation IntValue    `json:"animation"`
 		Blend     *FloatValue `json:"blend"`
@@ -801,8 +899,9 @@ func (imageObject *ImageObject) parseFromSceneJSON(raw json.RawMessage, pkgMap *
 	imageObject.Color = payload.Color
 	imageObject.Alpha = float32(payload.Alpha)
 	imageObject.Brightness = float32(payload.Brightness)
+	imageObject.UserBindings = parseUserBindings(raw, imageUserFields)
 
-	modelBytes, err := loadBytesFromPackage(pkgMap, imagePath)
+	modelBytes, err := loadBytesFromPackage(assets, imagePath)
 	if err != nil {
 		return fmt.Errorf("cannot load model image JSON %s: %w", imagePath, err)
 	}
@@ -830,7 +929,7 @@ func (imageObject *ImageObject) parseFromSceneJSON(raw json.RawMessage, pkgMap *
 	}
 	materialPath := string(model.Material)
 	imageObject.CompositionLayer = strings.Contains(materialPath, "composelayer")
-	materialBytes, err := loadBytesFromPackage(pkgMap, materialPath)
+	materialBytes, err := loadBytesFromPackage(assets, materialPath)
 	if err != nil {
 		return fmt.Errorf("cannot load material %s: %w", materialPath, err)
 	}
@@ -841,11 +940,11 @@ func (imageObject *ImageObject) parseFromSceneJSON(raw json.RawMessage, pkgMap *
 
 	if model.Puppet != "" {
 		puppetPath := string(model.Puppet)
-		puppetBytes, err := loadBytesFromPackage(pkgMap, puppetPath)
+		puppetBytes, err := loadBytesFromPackage(assets, puppetPath)
 		if err != nil {
 			return fmt.Errorf("cannot load puppet model %s: %w", puppetPath, err)
 		}
-		puppet, err := parsePuppetMetadata(puppetPath, puppetBytes)
+		puppet, err := ParsePuppetMetadata(puppetPath, puppetBytes)
 		if err != nil {
 			return fmt.Errorf("cannot parse puppet model %s: %w", puppetPath, err)
 		}
@@ -856,7 +955,7 @@ func (imageObject *ImageObject) parseFromSceneJSON(raw json.RawMessage, pkgMap *
 
 	for _, effectRaw := range payload.Effects {
 		var effect ImageEffect
-		if err := effect.parseFromSceneJSON(effectRaw, pkgMap); err != nil {
+		if err := effect.parseFromSceneJSON(effectRaw, assets); err != nil {
 			return err
 		}
 		imageObject.Effects = append(imageObject.Effects, effect)
@@ -1073,6 +1172,7 @@ type ParticleObject struct {
 	TextureRatio      float32
 	ParticleData      Particle
 	InstanceOverride  ParticleInstanceOverride
+	UserBindings      []UserBinding
 }
 
 func (override *ParticleInstanceOverride) parseFromJSON(raw json.RawMessage) error {
@@ -1716,7 +1816,7 @@ func (emitter *ParticleEmitter) parseFromJSON(raw json.RawMessage) error {
 	return nil
 }
 
-func (particle *Particle) parseFromJSON(raw json.RawMessage, pkgMap *map[string][]byte) error {
+func (particle *Particle) parseFromJSON(raw json.RawMessage, assets *AssetFS) error {
 	payload := struct {
 		Emitters           []json.RawMessage `json:"emitter"`
 		Renderers          []json.RawMessage `json:"renderer"`
@@ -1804,7 +1904,7 @@ func (particle *Particle) parseFromJSON(raw json.RawMessage, pkgMap *map[string]
 	if payload.Material == "" {
 		return fmt.Errorf("particle has no material field")
 	}
-	materialBytes, err := loadBytesFromPackage(pkgMap, string(payload.Material))
+	materialBytes, err := loadBytesFromPackage(assets, string(payload.Material))
 	if err != nil {
 		return fmt.Errorf("cannot load particle material %s: %w", string(payload.Material), err)
 	}
@@ -1824,7 +1924,7 @@ func (particle *Particle) parseFromJSON(raw json.RawMessage, pkgMap *map[string]
 	return nil
 }
 
-func (particleObject *ParticleObject) parseFromSceneJSON(raw json.RawMessage, pkgMap *map[string][]byte) error {
+func (particleObject *ParticleObject) parseFromSceneJSON(raw json.RawMessage, assets *AssetFS) error {
 	payload := struct {
 		ID               IntValue        `json:"id"`
 		Parent           IntValue        `json:"parent"`
@@ -1860,6 +1960,7 @@ func (particleObject *ParticleObject) parseFromSceneJSON(raw json.RawMessage, pk
 	particleObject.Scale = payload.Scale
 	particleObject.Angles = payload.Angles
 	particleObject.ParallaxDepth = payload.ParallaxDepth
+	particleObject.UserBindings = parseUserBindings(raw, objectUserFields)
 
 	if bytesFromRawNullAware(payload.InstanceOverride) != nil {
 		var instanceOverride ParticleInstanceOverride
@@ -1869,11 +1970,11 @@ func (particleObject *ParticleObject) parseFromSceneJSON(raw json.RawMessage, pk
 		particleObject.InstanceOverride = instanceOverride
 	}
 
-	particleBytes, err := loadBytesFromPackage(pkgMap, particlePath)
+	particleBytes, err := loadBytesFromPackage(assets, particlePath)
 	if err != nil {
 		return fmt.Errorf("cannot load particle file %s: %w", particlePath, err)
 	}
-	if err := particleObject.ParticleData.parseFromJSON(particleBytes, pkgMap); err != nil {
+	if err := particleObject.ParticleData.parseFromJSON(particleBytes, assets); err != nil {
 		return err
 	}
 
@@ -1913,6 +2014,16 @@ type Scene struct {
 	Textures          []ImportTextureTask
 	PassthroughShader int
 	AudioSpectrumSize int
+	// Hidden are the objects that user property overrides removed from Objects, they are only reported.
+	Hidden []HiddenObject
+}
+
+// HiddenObject is an object whose visibility resolved to false with the user property overrides, or a child of one.
+type HiddenObject struct {
+	ID     int
+	Name   string
+	Type   string
+	Reason string
 }
 
 func parseOrthogonalProjection(raw json.RawMessage) (OrthogonalProjection, error) {
@@ -2015,8 +2126,8 @@ func parseSceneGeneral(raw json.RawMessage) (SceneGeneral, error) {
 	return general, nil
 }
 
-func ParseScene(pkgMap *map[string][]byte) (Scene, error) {
-	sceneBytes, err := loadBytesFromPackage(pkgMap, "scene.json")
+func ParseScene(assets *AssetFS, overrides UserOverrides) (Scene, error) {
+	sceneBytes, err := loadBytesFromPackage(assets, "scene.json")
 	if err != nil {
 		return Scene{}, err
 	}
@@ -2033,7 +2144,11 @@ func ParseScene(pkgMap *map[string][]byte) (Scene, error) {
 	scene := Scene{}
 
 	if payload.General != nil {
-		general, parseErr := parseSceneGeneral(payload.General)
+		generalRaw, err := overrides.apply(payload.General)
+		if err != nil {
+			return Scene{}, fmt.Errorf("cannot apply overrides to general block: %w", err)
+		}
+		general, parseErr := parseSceneGeneral(generalRaw)
 		if parseErr != nil {
 			return Scene{}, parseErr
 		}
@@ -2042,8 +2157,12 @@ func ParseScene(pkgMap *map[string][]byte) (Scene, error) {
 		return Scene{}, fmt.Errorf("scene has no general block")
 	}
 
+	hiddenIDs := map[int]bool{}
 	for _, objectRaw := range payload.Objects {
 		var objectProbe struct {
+			ID       IntValue        `json:"id"`
+			Name     StringValue     `json:"name"`
+			Visible  json.RawMessage `json:"visible"`
 			Particle json.RawMessage `json:"particle"`
 			Image    json.RawMessage `json:"image"`
 		}
@@ -2051,15 +2170,40 @@ func ParseScene(pkgMap *map[string][]byte) (Scene, error) {
 		if parseErr != nil {
 			return Scene{}, fmt.Errorf("cannot parse object entry: %w", parseErr)
 		}
+		hidden, err := overrides.hidesObject(objectRaw)
+		if err != nil {
+			return Scene{}, fmt.Errorf("cannot apply overrides to object %d: %w", objectProbe.ID, err)
+		}
+		if hidden {
+			hiddenIDs[int(objectProbe.ID)] = true
+			objectType := "empty"
+			if len(objectProbe.Particle) > 0 {
+				objectType = "particle"
+			} else if len(objectProbe.Image) > 0 {
+				objectType = "image"
+			}
+			binding, _ := parseUserBinding(objectProbe.Visible, UserFieldVisible)
+			scene.Hidden = append(scene.Hidden, HiddenObject{
+				ID:     int(objectProbe.ID),
+				Name:   string(objectProbe.Name),
+				Type:   objectType,
+				Reason: fmt.Sprintf("hidden by user property %s", binding.Property),
+			})
+			continue
+		}
+		objectRaw, err = overrides.apply(objectRaw)
+		if err != nil {
+			return Scene{}, fmt.Errorf("cannot apply overrides to object %d: %w", objectProbe.ID, err)
+		}
 		if len(objectProbe.Particle) > 0 {
 			var particleObject ParticleObject
-			if err := particleObject.parseFromSceneJSON(objectRaw, pkgMap); err != nil {
+			if err := particleObject.parseFromSceneJSON(objectRaw, assets); err != nil {
 				return Scene{}, err
 			}
 			scene.Objects = append(scene.Objects, &particleObject)
 		} else if len(objectProbe.Image) > 0 {
 			var imageObject ImageObject
-			if err := imageObject.parseFromSceneJSON(objectRaw, pkgMap); err != nil {
+			if err := imageObject.parseFromSceneJSON(objectRaw, assets); err != nil {
 				return Scene{}, err
 			}
 			scene.Objects = append(scene.Objects, &imageObject)
@@ -2072,5 +2216,45 @@ func ParseScene(pkgMap *map[string][]byte) (Scene, error) {
 		}
 	}
 
+	var removed []SceneObject
+	scene.Objects, removed = removeObjectsWithParents(scene.Objects, hiddenIDs)
+	for objectIndex, object := range removed {
+		info := sceneObjectInfo(objectIndex, object)
+		scene.Hidden = append(scene.Hidden, HiddenObject{
+			ID:     info.ID,
+			Name:   info.Name,
+			Type:   info.Type,
+			Reason: fmt.Sprintf("parent object %d is hidden", info.Parent),
+		})
+	}
 	return scene, nil
 }
+
+// removeObjectsWithParents removes the objects with removedIDs and their descendants, it returns the remaining objects
+// and the removed descendants.
+func removeObjectsWithParents(objects []SceneObject, removedIDs map[int]bool) ([]SceneObject, []SceneObject) {
+	if len(removedIDs) == 0 {
+		return objects, nil
+	}
+	for changed := true; changed; {
+		changed = false
+		for objectIndex, object := range objects {
+			info := sceneObjectInfo(objectIndex, object)
+			if info.Parent >= 0 && removedIDs[info.Parent] && !removedIDs[info.ID] {
+				removedIDs[info.ID] = true
+				changed = true
+			}
+		}
+	}
+
+	filteredObjects := objects[:0]
+	removedObjects := []SceneObject{}
+	for objectIndex, object := range objects {
+		if removedIDs[sceneObjectInfo(objectIndex, object).ID] {
+			removedObjects = append(removedObjects, object)
+		} else {
+			filteredObjects = append(filteredObjects, object)
+		}
+	}
+	return filteredObjects, removedObjects
+}
@@ -0,0 +1,387 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"math"
+	"slices"
+)
+
+// sceneDataFile is the archive entry that module/scene_data.c loads the scene from.
+const sceneDataFile = "scene.bin"
+
+// sceneDataVersion must match WPE_SCENE_DATA_VERSION in module/scene_data.c, bump both when the layout changes.
+const sceneDataVersion = 1
+
+// nullString marks a string that is NULL on the C side, as opposed to an empty one.
+const nullString = math.MaxUint32
+
+// sceneDataWriter encodes the scene in the order module/scene_data.c reads it. Integers and floats are 32-bit
+// little endian, bools are one byte, strings are a length followed by the bytes and a zero, and arrays are
+// an element count followed by the elements.
+type sceneDataWriter struct {
+	buffer bytes.Buffer
+}
+
+func encodeSceneData(scene Scene) []byte {
+	writer := &sceneDataWriter{}
+	writer.buffer.WriteString("WPES")
+	writer.writeUint32(sceneDataVersion)
+
+	writer.writeCount(len(scene.Textures))
+	for _, texture := range scene.Textures {
+		writer.writeInt(texture.ID)
+		writer.writeString(texture.Name)
+		writer.writeInt(texture.Width)
+		writer.writeInt(texture.Height)
+		writer.writeBool(texture.ClampUV)
+		writer.writeBool(texture.Interpolation)
+	}
+
+	writer.writeCount(len(scene.Shaders))
+	for _, shader := range scene.Shaders {
+		writer.writeInt(shader.ID)
+		writer.writeString(shader.Name)
+		writer.writeUniforms(shader.VertexUniforms)
+		writer.writeUniforms(shader.FragmentUniforms)
+		writer.writeCount(len(shader.Attributes))
+		for _, attribute := range shader.Attributes {
+			writer.writeString(attribute.Name)
+			writer.writeString(attribute.Type)
+			writer.writeInt(attribute.ArraySize)
+		}
+		writer.writeCount(len(shader.Samplers))
+		for _, sampler := range shader.Samplers {
+			writer.writeString(sampler.Name)
+			writer.writeString(sampler.Default)
+			writer.writeInt(sampler.TextureSlot)
+		}
+	}
+
+	writer.writeCount(len(scene.Objects))
+	for objectIndex, object := range scene.Objects {
+		objectType := 2
+		if objectIndex < len(scene.Types) {
+			objectType = scene.Types[objectIndex]
+		}
+		writer.writeObject(objectType, object)
+	}
+
+	writer.writeGeneral(scene.General)
+	writer.writeInt(scene.PassthroughShader)
+	writer.writeInt(scene.AudioSpectrumSize)
+	return writer.buffer.Bytes()
+}
+
+func (writer *sceneDataWriter) writeUint32(value uint32) {
+	writer.buffer.Write(binary.LittleEndian.AppendUint32(nil, value))
+}
+
+func (writer *sceneDataWriter) writeInt(value int) {
+	writer.writeUint32(uint32(int32(value)))
+}
+
+func (writer *sceneDataWriter) writeCount(value int) {
+	writer.writeUint32(uint32(value))
+}
+
+func (writer *sceneDataWriter) writeBool(value bool) {
+	if value {
+		writer.buffer.WriteByte(1)
+	} else {
+		writer.buffer.WriteByte(0)
+	}
+}
+
+func (writer *sceneDataWriter) writeFloat(value float32) {
+	writer.writeUint32(math.Float32bits(value))
+}
+
+func (writer *sceneDataWriter) writeFloats(values ...float32) {
+	for _, value := range values {
+		writer.writeFloat(value)
+	}
+}
+
+func (writer *sceneDataWriter) writeFloatArray(values []float32) {
+	writer.writeCount(len(values))
+	writer.writeFloats(values...)
+}
+
+func (writer *sceneDataWriter) writeString(value string) {
+	writer.writeCount(len(value))
+	writer.buffer.WriteString(value)
+	writer.buffer.WriteByte(0)
+}
+
+func (writer *sceneDataWriter) writeNullableString(value string, ok bool) {
+	if !ok {
+		writer.writeUint32(nullString)
+		return
+	}
+	writer.writeString(value)
+}
+
+func (writer *sceneDataWriter) writeUniforms(uniforms []UniformInfo) {
+	writer.writeCount(len(uniforms))
+	for _, uniform := range uniforms {
+		writer.writeString(uniform.Name)
+		writer.writeString(uniform.ConstantName)
+		writer.writeString(uniform.Type)
+		writer.writeInt(uniform.ArraySize)
+		hasDefault := uniform.DefaultSet && len(uniform.Default) > 0
+		writer.writeBool(hasDefault)
+		if hasDefault {
+			writer.writeFloatArray(uniform.Default)
+		}
+	}
+}
+
+func (writer *sceneDataWriter) writeUserBindings(bindings []UserBinding) {
+	writer.writeCount(len(bindings))
+	for _, binding := range bindings {
+		writer.writeInt(int(binding.Field))
+		writer.writeString(binding.Property)
+		writer.writeNullableString(binding.Condition, binding.HasCondition)
+	}
+}
+
+func (writer *sceneDataWriter) writeMaterialTextures(names []string, ids []int) {
+	writer.writeCount(len(ids))
+	for textureIndex, id := range ids {
+		name := ""
+		if textureIndex < len(names) {
+			name = names[textureIndex]
+		}
+		writer.writeString(name)
+		writer.writeInt(id)
+	}
+}
+
+func (writer *sceneDataWriter) writeMaterial(material Material) {
+	writer.writeString(material.Blending)
+	writer.writeInt(material.CompiledShader)
+	writer.writeMaterialTextures(material.Textures, material.ImportedTextures)
+}
+
+func (writer *sceneDataWriter) writeEffects(effects []ImageEffect) {
+	writer.writeCount(len(effects))
+	for _, effect := range effects {
+		writer.writeString(effect.Name)
+		writer.writeBool(effect.Visible)
+		writer.writeUserBindings(effect.UserBindings)
+
+		writer.writeCount(len(effect.Passes))
+		for _, pass := range effect.Passes {
+			writer.writeMaterialTextures(pass.Textures, pass.ImportedTextures)
+			writer.writeCount(len(pass.Constants))
+			for _, name := range slices.Sorted(maps.Keys(pass.Constants)) {
+				writer.writeString(name)
+				writer.writeFloatArray(pass.Constants[name])
+			}
+			writer.writeString(pass.Target)
+			writer.writeCount(len(pass.Bind))
+			for _, bind := range pass.Bind {
+				writer.writeString(bind.Name)
+				writer.writeInt(bind.Index)
+			}
+		}
+
+		writer.writeCount(len(effect.FBOs))
+		for _, fbo := range effect.FBOs {
+			writer.writeString(fbo.Name)
+			writer.writeInt(fbo.Scale)
+		}
+		writer.writeCount(len(effect.Materials))
+		for _, material := range effect.Materials {
+			writer.writeMaterial(material)
+		}
+	}
+}
+
+// writeObject writes objectType, id and parent first. Objects that are not rendered are written as empty objects
+// whatever their Go type is, they only take part in transforms.
+func (writer *sceneDataWriter) writeObject(objectType int, object SceneObject) {
+	switch object := object.(type) {
+	case *ImageObject:
+		if objectType == 0 {
+			writer.writeImageObject(object)
+			return
+		}
+		writer.writeEmptyObject(object.ID, object.Parent, object.Origin, object.Scale, object.Angles)
+	case *ParticleObject:
+		if objectType == 1 {
+			writer.writeParticleObject(object)
+			return
+		}
+		writer.writeEmptyObject(object.ID, object.Parent, object.Origin, object.Scale, object.Angles)
+	case *EmptyObject:
+		writer.writeEmptyObject(object.ID, object.Parent, object.Origin, object.Scale, object.Angles)
+	default:
+		writer.writeEmptyObject(0, -1, Vector3{}, Vector3{1, 1, 1}, Vector3{})
+	}
+}
+
+func (writer *sceneDataWriter) writeObjectCommon(visible bool, bindings []UserBinding, name string, attachment string,
+	origin Vector3, scale Vector3, angles Vector3) {
+	writer.writeBool(visible)
+	writer.writeUserBindings(bindings)
+	writer.writeString(name)
+	writer.writeString(attachment)
+	writer.writeFloats(origin[:]...)
+	writer.writeFloats(scale[:]...)
+	writer.writeFloats(angles[:]...)
+}
+
+func (writer *sceneDataWriter) writeEmptyObject(id int, parent int, origin Vector3, scale Vector3, angles Vector3) {
+	writer.writeInt(2)
+	writer.writeInt(id)
+	writer.writeInt(parent)
+	writer.writeFloats(origin[:]...)
+	writer.writeFloats(scale[:]...)
+	writer.writeFloats(angles[:]...)
+}
+
+func (writer *sceneDataWriter) writeImageObject(object *ImageObject) {
+	writer.writeInt(0)
+	writer.writeInt(object.ID)
+	writer.writeInt(object.Parent)
+	writer.writeObjectCommon(object.Visible, object.UserBindings, object.Name, object.Attachment,
+		object.Origin, object.Scale, object.Angles)
+	writer.writeFloats(object.Size[:]...)
+	writer.writeBool(object.Perspective)
+	writer.writeFloats(object.ParallaxDepth[:]...)
+
+	writer.writeFloats(object.Color[:]...)
+	writer.writeInt(object.ColorBlendMode)
+	writer.writeFloat(object.Alpha)
+	writer.writeFloat(object.Brightness)
+	writer.writeBool(object.Fullscreen)
+	writer.writeBool(object.CompositionLayer)
+	writer.writeBool(object.Config.Passthrough)
+	writer.writeMaterial(object.Material)
+	writer.writeEffects(object.Effects)
+	hasPuppetMaterial := object.Puppet != nil && len(object.Effects) > 0
+	writer.writeBool(hasPuppetMaterial)
+	if hasPuppetMaterial {
+		writer.writeMaterial(object.PuppetMaterial)
+	}
+
+	writer.writeBool(object.Puppet != nil)
+	if object.Puppet != nil {
+		writer.writeString(object.Puppet.Path)
+		writer.writeInt(object.Puppet.BoneCount)
+		writer.writeCount(len(object.PuppetLayers))
+		for _, layer := range object.PuppetLayers {
+			writer.writeInt(layer.ID)
+			writer.writeFloat(layer.Blend)
+			writer.writeFloat(layer.Rate)
+			writer.writeBool(layer.Visible)
+			writer.writeBool(layer.Additive)
+			writer.writeBool(layer.BlendIn)
+			writer.writeBool(layer.BlendOut)
+			writer.writeFloat(layer.BlendTime)
+		}
+	}
+}
+
+func (writer *sceneDataWriter) writeParticleObject(object *ParticleObject) {
+	writer.writeInt(1)
+	writer.writeInt(object.ID)
+	writer.writeInt(object.Parent)
+	writer.writeObjectCommon(object.Visible, object.UserBindings, object.Name, object.Attachment,
+		object.Origin, object.Scale, object.Angles)
+	writer.writeBool(object.Perspective)
+	writer.writeFloats(object.ParallaxDepth[:]...)
+
+	particle := object.ParticleData
+	writer.writeMaterial(particle.Material)
+	writer.writeCount(len(particle.Emitters))
+	for _, emitter := range particle.Emitters {
+		writer.writeFloats(emitter.Directions[:]...)
+		writer.writeFloats(emitter.DistanceMax[:]...)
+		writer.writeFloats(emitter.DistanceMin[:]...)
+		writer.writeFloats(emitter.Origin[:]...)
+		for _, sign := range emitter.Sign {
+			writer.writeInt(int(sign))
+		}
+		writer.writeFloat(emitter.SpeedMin)
+		writer.writeFloat(emitter.SpeedMax)
+		writer.writeFloat(emitter.Rate)
+	}
+
+	init := particle.Initializer
+	writer.writeFloats(init.MinLifetime, init.MaxLifetime, init.MinSize, init.MaxSize)
+	writer.writeFloats(init.MinVelocity[:]...)
+	writer.writeFloats(init.MaxVelocity[:]...)
+	writer.writeFloats(init.MinRotation[:]...)
+	writer.writeFloats(init.MaxRotation[:]...)
+	writer.writeFloats(init.MinAngularVelocity[:]...)
+	writer.writeFloats(init.MaxAngularVelocity[:]...)
+	writer.writeFloats(init.MinColor[:]...)
+	writer.writeFloats(init.MaxColor[:]...)
+	writer.writeFloats(init.MinAlpha, init.MaxAlpha)
+	writer.writeBool(init.TurbulentVelocity)
+	writer.writeFloats(init.TurbulentScale, init.TurbulentTimeScale, init.TurbulentOffset, init.TurbulentSpeedMin,
+		init.TurbulentSpeedMax, init.TurbulentPhaseMin, init.TurbulentPhaseMax)
+	writer.writeFloats(init.TurbulentForward[:]...)
+	writer.writeFloats(init.TurbulentRight[:]...)
+	writer.writeInt(int(init.TurbulentAudio.Mode))
+	writer.writeFloat(init.TurbulentAudio.Exponent)
+	writer.writeFloats(init.TurbulentAudio.Bounds[:]...)
+	writer.writeInt(int(init.TurbulentAudio.FrequencyStart))
+	writer.writeInt(int(init.TurbulentAudio.FrequencyEnd))
+
+	operator := particle.Operator
+	writer.writeBool(operator.Movement.Enabled)
+	writer.writeFloats(operator.Movement.Gravity[:]...)
+	writer.writeFloats(operator.Movement.Drag, operator.Movement.Speed)
+
+	writer.writeBool(operator.AngularMovement.Enabled)
+	writer.writeFloat(operator.AngularMovement.Drag)
+	writer.writeFloats(operator.AngularMovement.Force[:]...)
+
+	writer.writeBool(operator.SizeChange.Enabled)
+	writer.writeFloats(operator.SizeChange.StartTime, operator.SizeChange.EndTime, operator.SizeChange.StartValue,
+		operator.SizeChange.EndValue)
+
+	writer.writeBool(operator.ColorChange.Enabled)
+	writer.writeFloats(operator.ColorChange.StartTime, operator.ColorChange.EndTime)
+	writer.writeFloats(operator.ColorChange.StartValue[:]...)
+	writer.writeFloats(operator.ColorChange.EndValue[:]...)
+
+	writer.writeBool(operator.AlphaFade.Enabled)
+	writer.writeFloats(operator.AlphaFade.FadeInTime, operator.AlphaFade.FadeOutTime)
+
+	oscillatePosition := operator.OscillatePosition
+	writer.writeBool(oscillatePosition.Enabled)
+	writer.writeFloats(oscillatePosition.Mask[:]...)
+	writer.writeFloats(oscillatePosition.FrequencyMin, oscillatePosition.FrequencyMax, oscillatePosition.PhaseMin,
+		oscillatePosition.PhaseMax, oscillatePosition.ScaleMin, oscillatePosition.ScaleMax)
+	for _, oscillate := range []OscillateScalarOperator{operator.OscillateAlpha, operator.OscillateSize} {
+		writer.writeBool(oscillate.Enabled)
+		writer.writeFloats(oscillate.FrequencyMin, oscillate.FrequencyMax, oscillate.PhaseMin, oscillate.PhaseMax,
+			oscillate.ScaleMin, oscillate.ScaleMax)
+	}
+
+	writer.writeInt(int(particle.MaxCount))
+	writer.writeFloat(particle.StartTime)
+	writer.writeFloat(particle.SequenceMultiplier)
+	writer.writeBool(particle.RandomFrame)
+	writer.writeInt(object.SpritesheetCols)
+	writer.writeInt(object.SpritesheetRows)
+	writer.writeInt(object.SpritesheetFrames)
+	writer.writeFloat(object.TextureRatio)
+}
+
+func (writer *sceneDataWriter) writeGeneral(general SceneGeneral) {
+	writer.writeBool(general.Parallax)
+	writer.writeFloats(general.ParallaxAmount, general.ParallaxDelay, general.ParallaxMouseInfluence)
+	writer.writeBool(general.Shake)
+	writer.writeFloats(general.ShakeAmplitude, general.ShakeRoughness, general.ShakeSpeed)
+	writer.writeBool(general.ClearEnabled)
+	writer.writeFloats(general.ClearColor[:]...)
+	writer.writeFloats(float32(general.Ortho.Width), float32(general.Ortho.Height))
+	writer.writeFloats(general.Zoom, general.FOV, general.NearZ, general.FarZ)
+}
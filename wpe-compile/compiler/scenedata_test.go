@@ -0,0 +1,438 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testScene has every kind of object and every optional part the scene data can hold, with values that differ
+// from each other, so that a field read from the wrong place shows up.
+func testScene() Scene {
+	image := &ImageObject{
+		ID: 10, Parent: -1, Visible: true, Name: "background", Attachment: "",
+		Origin: Vector3{1, 2, 3}, Scale: Vector3{4, 5, 6}, Angles: Vector3{7, 8, 9},
+		Size: Vector2{1920, 1080}, Perspective: true, ParallaxDepth: Vector2{0.25, 0.5},
+		Color: Vector3{0.1, 0.2, 0.3}, ColorBlendMode: 4, Alpha: 0.75, Brightness: 1.5,
+		Fullscreen: true, CompositionLayer: false, Config: ImageConfig{Passthrough: true},
+		Material: Material{Blending: "translucent", CompiledShader: 1, Textures: []string{"a", "b"},
+			ImportedTextures: []int{0, 1}},
+		Effects: []ImageEffect{{
+			Name: "waterripple", Visible: false,
+			UserBindings: []UserBinding{{Field: UserFieldVisible, Property: "ripple"}},
+			Passes: []MaterialPass{{
+				Textures: []string{"", "mask"}, ImportedTextures: []int{-1, 1},
+				Constants: map[string][]float32{"speed": {2}, "color": {1, 0.5, 0}}, Target: "_rt_FullFrameBuffer",
+				Bind: []MaterialPassBindItem{{Name: "previous", Index: 0}},
+			}},
+			FBOs:      []EffectFBO{{Name: "_rt_half", Scale: 2}},
+			Materials: []Material{{Blending: "normal", CompiledShader: 1, ImportedTextures: []int{1}}},
+		}},
+		Puppet:         &PuppetMetadata{Path: "models/puppet.mdl", BoneCount: 12},
+		PuppetMaterial: Material{Blending: "additive", CompiledShader: 0},
+		PuppetLayers: []PuppetAnimationLayer{{ID: 3, Blend: 0.5, Rate: 2, Visible: true, Additive: false,
+			BlendIn: true, BlendOut: false, BlendTime: 0.25}},
+		UserBindings: []UserBinding{
+			{Field: UserFieldAlpha, Property: "opacity"},
+			{Field: UserFieldVisible, Property: "mode", Condition: "2", HasCondition: true},
+			{Field: UserFieldVisible, Property: "empty", Condition: "", HasCondition: true},
+		},
+	}
+	particles := &ParticleObject{
+		ID: 20, Parent: 10, Visible: true, Name: "snow", Attachment: "head",
+		Origin: Vector3{-1, -2, -3}, Scale: Vector3{1, 1, 1}, Angles: Vector3{0, 0, 0.5},
+		ParallaxDepth: Vector2{1, 1}, SpritesheetCols: 4, SpritesheetRows: 2, SpritesheetFrames: 7,
+		TextureRatio: 0.5,
+		ParticleData: Particle{
+			Material: Material{Blending: "additive", CompiledShader: 2},
+			Emitters: []ParticleEmitter{{Directions: Vector3{1, 0, 0}, Sign: [3]int32{1, -1, 0}, SpeedMin: 3,
+				SpeedMax: 4, Rate: 60}},
+			Initializer:        ParticleInitializer{MinLifetime: 1, MaxLifetime: 2, MinSize: 3, MaxSize: 4},
+			Operator:           ParticleOperator{AlphaFade: AlphaFadeOperator{Enabled: true, FadeOutTime: 0.8}},
+			MaxCount:           500,
+			StartTime:          1.25,
+			SequenceMultiplier: 3,
+			RandomFrame:        true,
+		},
+	}
+	skipped := &ImageObject{ID: 30, Parent: 10, Name: "skipped", Origin: Vector3{1, 1, 1}, Scale: Vector3{2, 2, 2}}
+	empty := &EmptyObject{ID: 40, Parent: -1, Origin: Vector3{5, 5, 5}, Scale: Vector3{1, 1, 1}}
+
+	return Scene{
+		Objects: []SceneObject{image, particles, skipped, empty},
+		Types:   []int{0, 1, 2, 2},
+		Textures: []ImportTextureTask{
+			{ID: 0, Name: "materials/a", Width: 256, Height: 128, ClampUV: true},
+			{ID: 1, Name: "materials/b", Width: 64, Height: 32, Interpolation: true},
+		},
+		Shaders: []CompileShaderTask{{
+			ID: 1, Name: "genericimage2",
+			VertexUniforms: []UniformInfo{{Name: "g_ModelViewProjectionMatrix", Type: "mat4"}},
+			FragmentUniforms: []UniformInfo{
+				{Name: "g_Speed", ConstantName: "speed", Type: "float", Default: []float32{2}, DefaultSet: true},
+				{Name: "g_Color", ConstantName: "color", Type: "vec3", ArraySize: 2},
+			},
+			Attributes: []AttributeInfo{{Name: "a_Position", Type: "vec3"}, {Name: "a_Weights", Type: "vec4", ArraySize: 1}},
+			Samplers:   []SamplerInfo{{Name: "g_Texture0", Default: "util/white", TextureSlot: 0}},
+		}},
+		General: SceneGeneral{
+			Parallax: true, ParallaxAmount: 0.5, ParallaxDelay: 0.1, ParallaxMouseInfluence: 0.2,
+			Shake: true, ShakeAmplitude: 0.3, ShakeRoughness: 0.4, ShakeSpeed: 0.6,
+			ClearEnabled: true, ClearColor: Vector3{0.7, 0.8, 0.9},
+			Ortho: OrthogonalProjection{Width: 1920, Height: 1080}, Zoom: 1.1, FOV: 50, NearZ: 0.01, FarZ: 1000,
+		},
+		PassthroughShader: 3,
+		AudioSpectrumSize: 16,
+	}
+}
+
+// expectedSceneDump is what sceneDataHarness prints for testScene.
+const expectedSceneDump = `texture 0 materials/a 256x128 1 0
+texture 1 materials/b 64x32 0 1
+shader 1 genericimage2
+ uniform g_ModelViewProjectionMatrix  mat4 0
+ uniform g_Speed speed float 0 = 2
+ uniform g_Color color vec3 2
+ attribute a_Position vec3 0
+ attribute a_Weights vec4 1
+ sampler g_Texture0 util/white 0
+object 0 10 -1 background [] visible=1 1 2 3 / 4 5 6 / 7 8 9
+ binding 1 opacity [(null)]
+ binding 0 mode [2]
+ binding 0 empty []
+ image 1920x1080 perspective=1 0.25 0.5 color 0.1 0.2 0.3 4 0.75 1.5 1 0 1
+ material translucent 1 a=0 b=1
+ effect waterripple visible=0
+  binding 0 ripple [(null)]
+  pass _rt_FullFrameBuffer =-1 mask=1 color=1,0.5,0 speed=2 previous:0
+  fbo _rt_half 2
+  material normal 1 =1
+ puppet material additive 0
+ puppet models/puppet.mdl 12
+  layer 3 0.5 2 1 0 1 0 0.25
+object 1 20 10 snow [head] visible=1 -1 -2 -3 / 1 1 1 / 0 0 0.5
+ particle perspective=0 1 1
+ material additive 2
+ emitter 1 0 0 1 -1 0 3 4 60
+ init 1 2 3 4 fade 1 0.8
+ counts 500 1.25 3 1 4x2 7 0.5
+object 2 30 10  [(null)] visible=0 1 1 1 / 2 2 2 / 0 0 0
+object 2 40 -1  [(null)] visible=0 5 5 5 / 1 1 1 / 0 0 0
+general 1 0.5 0.1 0.2 1 0.3 0.4 0.6 1 0.7 0.8 0.9 1920x1080 1.1 50 0.01 1000
+passthrough 3 audio 16
+`
+
+// sceneDataHarness loads scene.bin with module/scene_data.c, the reader the scene module uses, and prints what
+// it read. With "prefixes" it instead reads every truncated copy of the file and prints how many were accepted.
+const sceneDataHarness = `#include "scene_data.c"
+
+static uint8_t* input_data;
+static size_t input_size;
+
+size_t ow_get_file_size(const char* path) {
+    (void)path;
+    return input_size;
+}
+
+void ow_read_file(const char* path, uint8_t* data) {
+    (void)path;
+    memcpy(data, input_data, input_size);
+}
+
+static const char* str(const char* value) {
+    return value == NULL ? "(null)" : value;
+}
+
+static void print_bindings(const char* indent, wpe_user_binding* bindings, int count) {
+    for(int i = 0; i < count; i++) {
+        printf("%sbinding %d %s [%s]\n", indent, bindings[i].field, str(bindings[i].option), str(bindings[i].condition));
+    }
+}
+
+static void print_uniforms(wpe_uniform_info* uniforms, int count) {
+    for(int i = 0; i < count; i++) {
+        printf(" uniform %s %s %s %d", uniforms[i].name, uniforms[i].constant_name, uniforms[i].type,
+            uniforms[i].array_size);
+        if(uniforms[i].default_set) {
+            printf(" =");
+            for(int j = 0; j < uniforms[i].default_len; j++) {
+                printf(" %g", uniforms[i].default_value[j]);
+            }
+        }
+        printf("\n");
+    }
+}
+
+static void print_textures(wpe_material_texture* textures, int count) {
+    for(int i = 0; i < count; i++) {
+        printf(" %s=%d", textures[i].name, textures[i].texture_id);
+    }
+}
+
+static void print_material(const char* indent, const char* label, wpe_material* material) {
+    printf("%s%s %s %d", indent, label, material->blending, material->shader_id);
+    print_textures(material->textures, material->num_textures);
+    printf("\n");
+}
+
+int main(int argc, char** argv) {
+    FILE* file = fopen(argv[1], "rb");
+    if(file == NULL) {
+        return 2;
+    }
+    fseek(file, 0, SEEK_END);
+    input_size = (size_t)ftell(file);
+    fseek(file, 0, SEEK_SET);
+    input_data = malloc(input_size + 1);
+    if(fread(input_data, 1, input_size, file) != input_size) {
+        return 2;
+    }
+    fclose(file);
+
+    if(argc > 2 && strcmp(argv[2], "prefixes") == 0) {
+        int accepted = 0;
+        for(size_t size = 0; size < input_size; size++) {
+            wpe_scene_reader reader = {.data = input_data, .size = size};
+            wpe_scene result = {0};
+            if(scene_read(&reader, &result)) {
+                accepted++;
+            }
+        }
+        printf("accepted %d\n", accepted);
+        return 0;
+    }
+
+    if(!wpe_load_scene("scene.bin")) {
+        return 1;
+    }
+    for(size_t i = 0; i < scene.num_textures; i++) {
+        wpe_texture* texture = &scene.textures[i];
+        printf("texture %d %s %dx%d %d %d\n", texture->id, texture->name, texture->width, texture->height,
+            texture->clamp_uv, texture->interpolation);
+    }
+    for(size_t i = 0; i < scene.num_shaders; i++) {
+        wpe_shader* shader = &scene.shaders[i];
+        printf("shader %d %s\n", shader->id, shader->name);
+        print_uniforms(shader->vertex_uniforms, shader->num_vertex_uniforms);
+        print_uniforms(shader->fragment_uniforms, shader->num_fragment_uniforms);
+        for(int j = 0; j < shader->num_attributes; j++) {
+            printf(" attribute %s %s %d\n", shader->attributes[j].name, shader->attributes[j].type,
+                shader->attributes[j].array_size);
+        }
+        for(int j = 0; j < shader->num_samplers; j++) {
+            printf(" sampler %s %s %d\n", shader->samplers[j].name, shader->samplers[j].default_texture,
+                shader->samplers[j].texture_slot);
+        }
+    }
+    for(size_t i = 0; i < scene.num_objects; i++) {
+        wpe_object* object = &scene.objects[i];
+        printf("object %d %d %d %s [%s] visible=%d %g %g %g / %g %g %g / %g %g %g\n", object->type, object->id,
+            object->parent, object->name, str(object->attachment), object->visible, object->origin.at[0],
+            object->origin.at[1], object->origin.at[2], object->scale.at[0], object->scale.at[1], object->scale.at[2],
+            object->angles.at[0], object->angles.at[1], object->angles.at[2]);
+        print_bindings(" ", object->user_bindings, object->num_user_bindings);
+        if(object->type == OBJECTTYPE_IMAGE) {
+            wpe_image_object* image = &object->image;
+            printf(" image %gx%g perspective=%d %g %g color %g %g %g %d %g %g %d %d %d\n", object->size.at[0],
+                object->size.at[1], object->perspective, object->parallax_depth.at[0], object->parallax_depth.at[1],
+                image->color.at[0], image->color.at[1], image->color.at[2], image->color_blend_mode, image->alpha,
+                image->brightness, image->fullscreen, image->composition_layer, image->passthrough);
+            print_material(" ", "material", &image->material);
+            for(int j = 0; j < image->num_effects; j++) {
+                wpe_image_effect* effect = &image->effects[j];
+                printf(" effect %s visible=%d\n", effect->name, effect->visible);
+                print_bindings("  ", effect->user_bindings, effect->num_user_bindings);
+                for(int k = 0; k < effect->num_passes; k++) {
+                    wpe_material_pass* pass = &effect->passes[k];
+                    printf("  pass %s", pass->target);
+                    print_textures(pass->textures, pass->num_textures);
+                    for(int c = 0; c < pass->num_constants; c++) {
+                        printf(" %s=", pass->constants[c].name);
+                        for(int v = 0; v < pass->constants[c].len; v++) {
+                            printf(v == 0 ? "%g" : ",%g", pass->constants[c].values[v]);
+                        }
+                    }
+                    for(int b = 0; b < pass->num_binds; b++) {
+                        printf(" %s:%d", pass->binds[b].name, pass->binds[b].index);
+                    }
+                    printf("\n");
+                }
+                for(int k = 0; k < effect->num_fbos; k++) {
+                    printf("  fbo %s %d\n", effect->fbos[k].name, effect->fbos[k].scale);
+                }
+                for(int k = 0; k < effect->num_materials; k++) {
+                    print_material("  ", "material", &effect->materials[k]);
+                }
+            }
+            if(image->puppet_material.blending != NULL) {
+                print_material(" ", "puppet material", &image->puppet_material);
+            }
+            if(image->puppet != NULL) {
+                printf(" puppet %s %d\n", image->puppet->path, image->puppet->num_bones);
+                for(int j = 0; j < image->puppet->num_layers; j++) {
+                    wpe_puppet_animation_layer* layer = &image->puppet->layers[j];
+                    printf("  layer %d %g %g %d %d %d %d %g\n", layer->id, layer->blend, layer->rate, layer->visible,
+                        layer->additive, layer->blend_in, layer->blend_out, layer->blend_time);
+                }
+            }
+        } else if(object->type == OBJECTTYPE_PARTICLE) {
+            wpe_particle_object* particle = &object->particle;
+            printf(" particle perspective=%d %g %g\n", object->perspective, object->parallax_depth.at[0],
+                object->parallax_depth.at[1]);
+            print_material(" ", "material", &particle->material);
+            for(int j = 0; j < particle->num_emitters; j++) {
+                wpe_particle_emitter* emitter = &particle->emitters[j];
+                printf(" emitter %g %g %g %d %d %d %g %g %g\n", emitter->directions[0], emitter->directions[1],
+                    emitter->directions[2], emitter->sign[0], emitter->sign[1], emitter->sign[2], emitter->speed_min,
+                    emitter->speed_max, emitter->rate);
+            }
+            printf(" init %g %g %g %g fade %d %g\n", particle->init.min_lifetime, particle->init.max_lifetime,
+                particle->init.min_size, particle->init.max_size, particle->operator.alpha_fade.enabled,
+                particle->operator.alpha_fade.fade_out_time);
+            printf(" counts %d %g %g %d %dx%d %d %g\n", particle->max_count, particle->start_time,
+                particle->sequence_multiplier, particle->random_frame, particle->spritesheet_cols,
+                particle->spritesheet_rows, particle->spritesheet_frames, particle->texture_ratio);
+        }
+    }
+    wpe_scene_general* general = &scene.general;
+    printf("general %d %g %g %g %d %g %g %g %d %g %g %g %gx%g %g %g %g %g\n", general->parallax,
+        general->parallax_amount, general->parallax_delay, general->parallax_mouse_influence, general->shake,
+        general->shake_amplitude, general->shake_roughness, general->shake_speed, general->clear_enabled,
+        general->clear_color.at[0], general->clear_color.at[1], general->clear_color.at[2], general->ortho.at[0],
+        general->ortho.at[1], general->zoom, general->fov, general->near_z, general->far_z);
+    printf("passthrough %d audio %d\n", scene.passthrough_shader_id, scene.audio_spectrum_size);
+    return 0;
+}
+`
+
+func TestEncodeSceneData(t *testing.T) {
+	data := encodeSceneData(Scene{PassthroughShader: -1})
+	if !bytes.HasPrefix(data, []byte("WPES")) || binary.LittleEndian.Uint32(data[4:]) != sceneDataVersion {
+		t.Fatalf("scene data starts with %q", data[:8])
+	}
+	// Three empty arrays, the general settings with 3 bools and 15 floats, the passthrough shader and the audio
+	// spectrum size.
+	if expected := 8 + 3*4 + (3 + 15*4) + 4 + 4; len(data) != expected {
+		t.Errorf("empty scene takes %d bytes, want %d", len(data), expected)
+	}
+	if binary.LittleEndian.Uint32(data[len(data)-8:]) != 0xffffffff {
+		t.Error("passthrough shader -1 is not written as a 32-bit -1")
+	}
+
+	scene := testScene()
+	if !bytes.Equal(encodeSceneData(scene), encodeSceneData(testScene())) {
+		t.Error("encoding the same scene twice gives different data")
+	}
+
+	skipped := scene.Objects[2].(*ImageObject)
+	asEmpty := &EmptyObject{ID: skipped.ID, Parent: skipped.Parent, Origin: skipped.Origin, Scale: skipped.Scale,
+		Angles: skipped.Angles}
+	if !bytes.Equal(encodeSceneData(Scene{Objects: []SceneObject{skipped}, Types: []int{2}}),
+		encodeSceneData(Scene{Objects: []SceneObject{asEmpty}, Types: []int{2}})) {
+		t.Error("a skipped image object is not written as an empty object")
+	}
+	if !bytes.Equal(encodeSceneData(Scene{Objects: []SceneObject{skipped}}),
+		encodeSceneData(Scene{Objects: []SceneObject{asEmpty}, Types: []int{2}})) {
+		t.Error("an object without a type is not written as an empty object")
+	}
+
+	writer := &sceneDataWriter{}
+	writer.writeNullableString("", false)
+	writer.writeNullableString("", true)
+	writer.writeString("ab")
+	if expected := []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'a', 'b', 0}; !bytes.Equal(writer.buffer.Bytes(),
+		expected) {
+		t.Errorf("strings = %v, want %v", writer.buffer.Bytes(), expected)
+	}
+}
+
+// buildSceneDataHarness compiles sceneDataHarness with the host C compiler, the test is skipped if there is none.
+func buildSceneDataHarness(t *testing.T) string {
+	t.Helper()
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no host C compiler to build module/scene_data.c with")
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"scene_data.c":    sceneDataCode,
+		"defs.h":          defsCode,
+		"openwallpaper.h": []byte(openwallpaperHeader),
+		"harness.c":       []byte(sceneDataHarness),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	harness := filepath.Join(dir, "harness")
+	if output, err := exec.Command(cc, "-std=gnu11", "-w", "-o", harness, filepath.Join(dir, "harness.c"),
+		"-lm").CombinedOutput(); err != nil {
+		t.Fatalf("building the harness failed: %v\n%s", err, output)
+	}
+	return harness
+}
+
+func runSceneDataHarness(t *testing.T, harness string, data []byte, args ...string) (string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scene.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := exec.Command(harness, append([]string{path}, args...)...).Output()
+	return string(output), err
+}
+
+func TestSceneDataRoundTrip(t *testing.T) {
+	harness := buildSceneDataHarness(t)
+	data := encodeSceneData(testScene())
+
+	dump, err := runSceneDataHarness(t, harness, data)
+	if err != nil {
+		t.Fatalf("scene_data.c rejected the scene: %v\n%s", err, dump)
+	}
+	if dump != expectedSceneDump {
+		t.Errorf("scene_data.c read\n%s\nwant\n%s", dump, expectedSceneDump)
+	}
+
+	output, err := runSceneDataHarness(t, harness, data, "prefixes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(output), "\n"); lines[len(lines)-1] != "accepted 0" {
+		t.Errorf("truncated scene data was accepted: %s", lines[len(lines)-1])
+	}
+
+	wrongVersion := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(wrongVersion[4:], sceneDataVersion+1)
+	brokenString := bytes.Clone(data)
+	// The name of the first texture starts after the header, the texture count and its ID and length.
+	brokenString[8+4+4+4+len("materials/a")] = 'x'
+	tests := []struct {
+		name   string
+		data   []byte
+		output string
+	}{
+		{"empty", nil, "no WPES header"},
+		{"wrong magic", append([]byte("WPEX"), data[4:]...), "no WPES header"},
+		{"wrong version", wrongVersion, "version 2 is not supported"},
+		{"trailing data", append(bytes.Clone(data), 0), "scene data is broken"},
+		{"string without terminator", brokenString, "scene data is broken"},
+		{"huge array", append(bytes.Clone(data[:8]), 0xff, 0xff, 0xff, 0x7f), "scene data is broken"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := runSceneDataHarness(t, harness, test.data)
+			if err == nil {
+				t.Fatalf("scene_data.c accepted the scene data:\n%s", output)
+			}
+			if !strings.Contains(output, test.output) {
+				t.Errorf("output = %q, want one containing %q", output, test.output)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
-package main
+package compiler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -40,6 +45,27 @@ type PreprocessedShader struct {
 	FragmentUniforms []UniformInfo
 	Attributes       []AttributeInfo
 	Samplers         []SamplerInfo
+	Warnings         []string
+}
+
+// GLSLCError is returned when glslc rejects a shader, Log is what glslc printed.
+type GLSLCError struct {
+	Preprocessor bool
+	Log          string
+}
+
+func (err *GLSLCError) Error() string {
+	if err.Preprocessor {
+		return "glslc preprocessor failed: " + err.Log
+	}
+	return "glslc failed:\n" + err.Log
+}
+
+func glslcLog(output []byte, err error) string {
+	if len(output) == 0 {
+		return err.Error()
+	}
+	return string(output)
 }
 
 type comboMeta struct {
@@ -52,7 +78,8 @@ type samplerMeta struct {
 	Default string `json:"default"`
 }
 
-func preprocessShader(vertexSource, fragmentSource, includePath string, boundTextures []bool, comboOverrides map[string]int) (PreprocessedShader, error) {
+func PreprocessShader(ctx context.Context, vertexSource, fragmentSource, includePath string, boundTextures []bool, comboOverrides map[string]int) (PreprocessedShader, error) {
+	warnings := []string{}
 	vertexSource = renameSymbol(vertexSource, "sample", "sample_")
 	fragmentSource = renameSymbol(fragmentSource, "sample", "sample_")
 
@@ -62,10 +89,10 @@ func preprocessShader(vertexSource, fragmentSource, includePath string, boundTex
 	vertexSource = removePrecisionSpecifiers(vertexSource)
 	fragmentSource = removePrecisionSpecifiers(fragmentSource)
 
-	vertexUniformConstantNames := parseUniformConstantNames(vertexSource)
-	vertexUniformDefaults := parseUniformDefaults(vertexSource)
-	fragmentUniformConstantNames := parseUniformConstantNames(fragmentSource)
-	fragmentUniformDefaults := parseUniformDefaults(fragmentSource)
+	vertexUniformConstantNames := parseUniformConstantNames(vertexSource, &warnings)
+	vertexUniformDefaults := parseUniformDefaults(vertexSource, &warnings)
+	fragmentUniformConstantNames := parseUniformConstantNames(fragmentSource, &warnings)
+	fragmentUniformDefaults := parseUniformDefaults(fragmentSource, &warnings)
 
 	vertexSource = appendGLSL450Header(vertexSource)
 	fragmentSource = appendGLSL450Header(fragmentSource)
@@ -74,12 +101,12 @@ func preprocessShader(vertexSource, fragmentSource, includePath string, boundTex
 	vertexSource = removeUnmatchedEndifs(vertexSource)
 	fragmentSource = removeUnmatchedEndifs(fragmentSource)
 
-	vertexCombos, vertexDefaults := parseSamplerCombos(vertexSource, boundTextures)
-	fragmentCombos, fragmentDefaults := parseSamplerCombos(fragmentSource, boundTextures)
+	vertexCombos, vertexDefaults := parseSamplerCombos(vertexSource, boundTextures, &warnings)
+	fragmentCombos, fragmentDefaults := parseSamplerCombos(fragmentSource, boundTextures, &warnings)
 
 	combos := map[string]int{}
-	maps.Copy(combos, parseCombos(vertexSource))
-	maps.Copy(combos, parseCombos(fragmentSource))
+	maps.Copy(combos, parseCombos(vertexSource, &warnings))
+	maps.Copy(combos, parseCombos(fragmentSource, &warnings))
 	maps.Copy(combos, vertexCombos)
 	maps.Copy(combos, fragmentCombos)
 
@@ -87,11 +114,11 @@ func preprocessShader(vertexSource, fragmentSource, includePath string, boundTex
 		combos[combo] = value
 	}
 
-	vertexSource, err := runGLSLCPreprocessor(vertexSource, includePath, combos)
+	vertexSource, err := runGLSLCPreprocessor(ctx, vertexSource, includePath, combos)
 	if err != nil {
 		return PreprocessedShader{}, err
 	}
-	fragmentSource, err = runGLSLCPreprocessor(fragmentSource, includePath, combos)
+	fragmentSource, err = runGLSLCPreprocessor(ctx, fragmentSource, includePath, combos)
 	if err != nil {
 		return PreprocessedShader{}, err
 	}
@@ -100,8 +127,8 @@ func preprocessShader(vertexSource, fragmentSource, includePath string, boundTex
 	fragmentSource = rewriteHLSLImplicitConversions(fragmentSource)
 
 	vertexSource, attributes := preprocessVertexAttributes(vertexSource)
-	vertexSource, vertexVarying := findAndRemoveVarying(vertexSource)
-	fragmentSource, fragmentVarying := findAndRemoveVarying(fragmentSource)
+	vertexSource, vertexVarying := findAndRemoveVarying(vertexSource, &warnings)
+	fragmentSource, fragmentVarying := findAndRemoveVarying(fragmentSource, &warnings)
 
 	for name, info := range fragmentVarying {
 		vertexInfo, exists := vertexVarying[name]
@@ -134,8 +161,8 @@ func preprocessShader(vertexSource, fragmentSource, includePath string, boundTex
 	vertexSource = insertIntermediateAttributes(vertexSource, varying, "out")
 	fragmentSource = insertIntermediateAttributes(fragmentSource, varying, "in")
 
-	vertexSource, vertexUniforms := preprocessUniforms(vertexSource, 1)
-	fragmentSource, fragmentUniforms := preprocessUniforms(fragmentSource, 3)
+	vertexSource, vertexUniforms := preprocessUniforms(vertexSource, 1, &warnings)
+	fragmentSource, fragmentUniforms := preprocessUniforms(fragmentSource, 3, &warnings)
 	fragmentSource = preprocessFragColor(fragmentSource)
 
 	for i := range vertexUniforms {
@@ -183,6 +210,7 @@ func preprocessShader(vertexSource, fragmentSource, includePath string, boundTex
 		Samplers:         samplers,
 		VertexUniforms:   vertexUniforms,
 		FragmentUniforms: fragmentUniforms,
+		Warnings:         warnings,
 	}, nil
 }
 
@@ -708,7 +736,7 @@ func expandedVectorSwizzle(sourceComponents int, targetComponents int) string {
 	return vectorSwizzle(targetComponents)
 }
 
-func parseUniformConstantNames(source string) map[string]string {
+func parseUniformConstantNames(source string, warnings *[]string) map[string]string {
 	reUniform := regexp.MustCompile(`uniform\s*([a-z|A-Z|0-9|_]*)\s*([a-z|A-Z|0-9|_]*)\s*;\s*\/\/\s*({.*})`)
 	matches := reUniform.FindAllStringSubmatch(source, -1)
 	constantNames := map[string]string{}
@@ -722,7 +750,7 @@ func parseUniformConstantNames(source string) map[string]string {
 		var meta uniformMeta
 		err := json.Unmarshal([]byte(match[3]), &meta)
 		if err != nil {
-			fmt.Printf("warning: unable to parse uniform properties JSON for %s: %s\n", match[2], err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse uniform properties JSON for %s: %s", match[2], err.Error()))
 			continue
 		}
 		constantName := string(meta.ConstantName)
@@ -734,7 +762,7 @@ func parseUniformConstantNames(source string) map[string]string {
 	return constantNames
 }
 
-func parseUniformDefaults(source string) map[string][]float32 {
+func parseUniformDefaults(source string, warnings *[]string) map[string][]float32 {
 	reUniform := regexp.MustCompile(`uniform\s*([a-z|A-Z|0-9|_]*)\s*([a-z|A-Z|0-9|_]*)\s*;\s*\/\/\s*({.*})`)
 	matches := reUniform.FindAllStringSubmatch(source, -1)
 	defaults := map[string][]float32{}
@@ -748,12 +776,12 @@ func parseUniformDefaults(source string) map[string][]float32 {
 		var meta uniformMeta
 		err := json.Unmarshal([]byte(match[3]), &meta)
 		if err != nil {
-			fmt.Printf("warning: unable to parse uniform properties JSON for %s: %s\n", match[2], err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse uniform properties JSON for %s: %s", match[2], err.Error()))
 			continue
 		}
 		value, err := parseFloatSliceFromRaw(meta.Default)
 		if err != nil {
-			fmt.Printf("warning: unable to parse uniform properties JSON for %s: %s\n", match[2], err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse uniform properties JSON for %s: %s", match[2], err.Error()))
 			continue
 		}
 		defaults[match[2]] = value
@@ -761,7 +789,7 @@ func parseUniformDefaults(source string) map[string][]float32 {
 	return defaults
 }
 
-func parseCombos(source string) map[string]int {
+func parseCombos(source string, warnings *[]string) map[string]int {
 	combos := make(map[string]int)
 	reCombo := regexp.MustCompile(`//\s*\[COMBO\]\s*({.*})`)
 	matches := reCombo.FindAllStringSubmatch(source, -1)
@@ -770,7 +798,7 @@ func parseCombos(source string) map[string]int {
 		combo := comboMeta{}
 		err := json.Unmarshal([]byte(comboJSON), &combo)
 		if err != nil {
-			fmt.Printf("warning: unable to parse combo JSON %s: %s\n", comboJSON, err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse combo JSON %s: %s", comboJSON, err.Error()))
 			continue
 		}
 		combos[combo.Combo] = combo.Default
@@ -778,7 +806,7 @@ func parseCombos(source string) map[string]int {
 	return combos
 }
 
-func parseSamplerCombos(source string, boundTextures []bool) (map[string]int, map[string]string) {
+func parseSamplerCombos(source string, boundTextures []bool, warnings *[]string) (map[string]int, map[string]string) {
 	combos := map[string]int{}
 	defaults := map[string]string{}
 	reSamplerCombo := regexp.MustCompile(`uniform\s*sampler2D\s*([a-z|A-Z|0-9|_]*)\s*;\s*//\s*({.*})`)
@@ -788,7 +816,7 @@ func parseSamplerCombos(source string, boundTextures []bool) (map[string]int, ma
 		meta := samplerMeta{}
 		err := json.Unmarshal([]byte(metaJSON), &meta)
 		if err != nil {
-			fmt.Printf("warning: unable to parse combo JSON %s: %s\n", metaJSON, err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse combo JSON %s: %s", metaJSON, err.Error()))
 			continue
 		}
 		textureSlot := idx
@@ -821,12 +849,63 @@ func parseTextureSlotFromSamplerName(name string) (int, bool) {
 	return slot, true
 }
 
-func runGLSLCPreprocessor(source, includePath string, defines map[string]int) (string, error) {
-	tempDirBytes, err := exec.Command("mktemp", "-d").Output()
+var shaderIncludePattern = regexp.MustCompile(`(?m)^\s*#\s*include\s+"([^"]+)"`)
+
+// shaderIncludes returns the files the sources include, directly or through other includes, by include name. They are
+// read from shaders/ in the asset layers like the shaders themselves. Missing files are kept with nil content, so that
+// they are part of the cache key and glslc reports them.
+func (job *compileJob) shaderIncludes(sources ...string) map[string][]byte {
+	includes := map[string][]byte{}
+	for len(sources) > 0 {
+		source := sources[0]
+		sources = sources[1:]
+		for _, match := range shaderIncludePattern.FindAllStringSubmatch(source, -1) {
+			name := match[1]
+			if _, visited := includes[name]; visited {
+				continue
+			}
+			content, _ := job.assets.ReadFile("shaders/" + name)
+			includes[name] = content
+			sources = append(sources, string(content))
+		}
+	}
+	return includes
+}
+
+// shaderIncludesKey returns the names and contents of includes sorted by name for the cache key of a shader.
+func shaderIncludesKey(includes map[string][]byte) []byte {
+	result := bytes.Buffer{}
+	for _, name := range slices.Sorted(maps.Keys(includes)) {
+		content := includes[name]
+		fmt.Fprintf(&result, "%s\x00%d\x00", name, len(content))
+		result.Write(content)
+	}
+	return result.Bytes()
+}
+
+// writeShaderIncludes writes the includes that were found into dir, which is passed to glslc as the include path,
+// so that glslc reads the same files that the cache key was made from.
+func writeShaderIncludes(dir string, includes map[string][]byte) error {
+	for name, content := range includes {
+		if content == nil || !fs.ValidPath(name) {
+			continue
+		}
+		includePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(includePath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(includePath, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runGLSLCPreprocessor(ctx context.Context, source, includePath string, defines map[string]int) (string, error) {
+	tempDir, err := os.MkdirTemp("", "wpe-compile-")
 	if err != nil {
-		return "", errors.New("mktemp failed: " + err.Error())
+		return "", errors.New("creating temp dir failed: " + err.Error())
 	}
-	tempDir := strings.TrimSuffix(string(tempDirBytes), "\n")
 	defer os.RemoveAll(tempDir)
 
 	err = os.WriteFile(tempDir+"/shader.glsl", []byte(source), 0644)
@@ -834,17 +913,27 @@ func runGLSLCPreprocessor(source, includePath string, defines map[string]int) (s
 		return "", errors.New("writing shader failed: " + err.Error())
 	}
 
-	glslcArgs := []string{"-E", tempDir + "/shader.glsl", "-I", includePath}
-	for name, value := range defines {
-		glslcArgs = append(glslcArgs, fmt.Sprintf("-D%s=%d", name, value))
+	glslcArgs := append([]string{"-E", tempDir + "/shader.glsl", "-I", includePath}, defineArgs(defines)...)
+	resultBytes, err := runTool(ctx, "glslc", glslcArgs...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", &GLSLCError{Preprocessor: true, Log: glslcLog(resultBytes, err)}
 	}
-	resultBytes, err := exec.Command("glslc", glslcArgs...).CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("glslc preprocessor failed: %s", resultBytes)
+		return "", err
 	}
 	return normalizeNewlines(string(resultBytes)), nil
 }
 
+// defineArgs returns glslc -D arguments sorted by name, so that the same defines always give the same command.
+func defineArgs(defines map[string]int) []string {
+	args := []string{}
+	for _, name := range slices.Sorted(maps.Keys(defines)) {
+		args = append(args, fmt.Sprintf("-D%s=%d", name, defines[name]))
+	}
+	return args
+}
+
 func preprocessVertexAttributes(source string) (string, []AttributeInfo) {
 	reAttribute := regexp.MustCompile(`attribute\s+([^\s]+)\s+([^\s;]+)\s*;`)
 	attributes := []AttributeInfo{}
@@ -860,7 +949,7 @@ func preprocessVertexAttributes(source string) (string, []AttributeInfo) {
 	return source, attributes
 }
 
-func findAndRemoveVarying(source string) (string, map[string]AttributeInfo) {
+func findAndRemoveVarying(source string, warnings *[]string) (string, map[string]AttributeInfo) {
 	reVarying := regexp.MustCompile(`varying\s+([a-z|A-Z|0-9|_]*)\s+([a-z|A-Z|0-9|_|\s]*)\s*;`)
 	varying := map[string]AttributeInfo{}
 	source = reVarying.ReplaceAllStringFunc(source, func(match string) string {
@@ -878,7 +967,7 @@ func findAndRemoveVarying(source string) (string, map[string]AttributeInfo) {
 		submatches := reVaryingArray.FindStringSubmatch(match)
 		arraySize, err := strconv.Atoi(submatches[3])
 		if err != nil {
-			fmt.Printf("warning: unable to parse varying %s array size (%s): %s\n", match, submatches[3], err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse varying %s array size (%s): %s", match, submatches[3], err.Error()))
 			return match
 		}
 		varying[submatches[2]] = AttributeInfo{
@@ -1005,7 +1094,7 @@ func sourceUsesIdentifier(source string, identifier string) bool {
 	return reIdentifier.FindStringIndex(source) != nil
 }
 
-func preprocessUniforms(source string, set int) (string, []UniformInfo) {
+func preprocessUniforms(source string, set int, warnings *[]string) (string, []UniformInfo) {
 	reUniform := regexp.MustCompile(`uniform\s*([a-z|A-Z|0-9|_]*)\s*([a-z|A-Z|0-9|_]*)\s*;`)
 	uniforms := []UniformInfo{}
 
@@ -1029,7 +1118,7 @@ func preprocessUniforms(source string, set int) (string, []UniformInfo) {
 		}
 		arraySize, err := strconv.Atoi(match[3])
 		if err != nil {
-			fmt.Printf("warning: unable to parse array size %s: %s\n", match[3], err.Error())
+			*warnings = append(*warnings, fmt.Sprintf("unable to parse array size %s: %s", match[3], err.Error()))
 			continue
 		}
 		uniforms = append(uniforms, UniformInfo{
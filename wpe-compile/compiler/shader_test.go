@@ -0,0 +1,61 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShaderIncludes(t *testing.T) {
+	projectDir := t.TempDir()
+	assetRoot := t.TempDir()
+	files := map[string]string{
+		filepath.Join(projectDir, "scene.json"):            `{"objects":[]}`,
+		filepath.Join(projectDir, "shaders", "common.h"):   "#include \"math/util.h\"\nproject common",
+		filepath.Join(assetRoot, "shaders", "common.h"):    "asset root common",
+		filepath.Join(assetRoot, "shaders", "math/util.h"): "asset root util",
+		filepath.Join(assetRoot, "shaders", "unused.h"):    "unused",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assets, err := OpenAssets(projectDir, []string{assetRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+
+	job := &compileJob{assets: assets}
+	includes := job.shaderIncludes("#include \"common.h\"\nvoid main() {}", "# include \"missing.h\"")
+	expected := map[string][]byte{
+		"common.h":    []byte("#include \"math/util.h\"\nproject common"),
+		"math/util.h": []byte("asset root util"),
+		"missing.h":   nil,
+	}
+	if !reflect.DeepEqual(includes, expected) {
+		t.Errorf("includes = %q, want %q", includes, expected)
+	}
+
+	includeDir := t.TempDir()
+	if err := writeShaderIncludes(includeDir, includes); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range expected {
+		written, err := os.ReadFile(filepath.Join(includeDir, filepath.FromSlash(name)))
+		if content == nil {
+			if err == nil {
+				t.Errorf("missing include %s was written", name)
+			}
+			continue
+		}
+		if err != nil || string(written) != string(content) {
+			t.Errorf("%s = %q, %v, want %q", name, written, err, content)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"bytes"
@@ -31,7 +31,7 @@ type WebpResult struct {
 	SpritesheetDuration float32
 }
 
-func texToWebp(texBytes []byte, metadataBytes []byte) (WebpResult, error) {
+func TexToWebp(texBytes []byte, metadataBytes []byte) (WebpResult, error) {
 	reader := bytes.NewReader(texBytes)
 
 	magic1, err := readCString(reader, 16)
@@ -74,7 +74,7 @@ func texToWebp(texBytes []byte, metadataBytes []byte) (WebpResult, error) {
 	}
 
 	if header.Flags&texFlagIsVideoTexture != 0 || imageFormat == freeImageMp4 {
-		return WebpResult{}, errors.New("video textures (MP4) are not supported by texToWebp")
+		return WebpResult{}, errors.New("video textures (MP4) are not supported by TexToWebp")
 	}
 
 	var firstMipmap texMipmap
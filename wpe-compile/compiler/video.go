@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// findInputProject returns the project.json for the input, or "" if there is none. A project.json found next to
+// a pkg whose file field names another file only describes the wallpaper, matchesInput is false then and the pkg is
+// converted as a scene. Next to any other input file such a project.json is an error, the input would be converted
+// with the type and options of another wallpaper.
+func (job *compileJob) findInputProject() (projectPath string, matchesInput bool, err error) {
+	if job.options.Project != "" {
+		return job.options.Project, true, nil
+	}
+	info, err := os.Stat(job.options.Input)
+	if err != nil {
+		return "", false, NewError(InputError, fmt.Errorf("open input failed: %w", err))
+	}
+	if info.IsDir() {
+		if projectPath := filepath.Join(job.options.Input, "project.json"); isRegularFile(projectPath) {
+			return projectPath, true, nil
+		}
+		return "", false, nil
+	}
+
+	projectPath = filepath.Join(filepath.Dir(job.options.Input), "project.json")
+	if !isRegularFile(projectPath) {
+		return "", false, nil
+	}
+	project, err := loadProject(projectPath)
+	if err != nil {
+		job.warnf("ignoring %s: %s", projectPath, err)
+		return "", false, nil
+	}
+	if project.File != "" && !projectNamesInput(project, job.options.Input) {
+		if inputType(job.options.Input) != "scene" {
+			return "", false, NewError(InputError, fmt.Errorf("%s describes %s instead of %s, pass --project to use "+
+				"another one", projectPath, path.Base(project.File), filepath.Base(job.options.Input)))
+		}
+		job.warnf("%s describes %s instead of %s, only using it for metadata, pass --project to use another one",
+			projectPath, path.Base(project.File), filepath.Base(job.options.Input))
+		return projectPath, false, nil
+	}
+	return projectPath, true, nil
+}
+
+// projectNamesInput tells whether the file field of a project.json names the input file. Scene projects name the
+// scene.json packed in their pkg instead of the pkg itself.
+func projectNamesInput(project Project, input string) bool {
+	if project.File == "" {
+		return false
+	}
+	projectFile := path.Base(project.File)
+	isPkg := strings.EqualFold(filepath.Ext(input), ".pkg")
+	return strings.EqualFold(projectFile, filepath.Base(input)) || (isPkg && strings.EqualFold(projectFile, "scene.json"))
+}
+
+func (job *compileJob) compileWallpaper() error {
+	projectPath, matchesInput, err := job.findInputProject()
+	if err != nil {
+		return err
+	}
+	if projectPath == "" {
+		if inputType(job.options.Input) == "video" {
+			project := Project{Title: defaultProjectTitle(job.options.Input), Type: "video"}
+			return job.compileVideo(project, "")
+		}
+		return job.compileScene("")
+	}
+	project, err := loadProject(projectPath)
+	if err != nil {
+		if job.options.Project == "" {
+			job.warnf("ignoring %s: %s", projectPath, err)
+			return job.compileScene("")
+		}
+		return NewError(InputError, err)
+	}
+
+	projectType := strings.ToLower(strings.TrimSpace(project.Type))
+	if !matchesInput {
+		projectType = inputType(job.options.Input)
+	}
+	switch projectType {
+	case "", "scene":
+		return job.compileScene(projectPath)
+	case "video":
+		return job.compileVideo(project, projectPath)
+	default:
+		if !job.inputHasScene() {
+			return NewError(InputError, fmt.Errorf("%w %q", ErrUnsupportedProject, project.Type))
+		}
+		job.warnf("project type %q is not supported, converting scene.json as a scene", project.Type)
+		return job.compileScene(projectPath)
+	}
+}
+
+// videoExtensions are the containers video wallpapers come in.
+var videoExtensions = []string{".mp4", ".webm", ".mkv", ".mov", ".avi", ".m4v", ".ogv"}
+
+// inputType tells how an input file is converted without a project.json describing it: a pkg is a scene, a known
+// video container is a video, and other files are neither.
+func inputType(input string) string {
+	extension := strings.ToLower(filepath.Ext(input))
+	switch {
+	case extension == ".pkg":
+		return "scene"
+	case slices.Contains(videoExtensions, extension):
+		return "video"
+	}
+	return ""
+}
+
+// inputHasScene tells whether the input has a scene.json, in the project directory or in scene.pkg.
+func (job *compileJob) inputHasScene() bool {
+	assets, err := OpenAssets(job.options.Input, nil)
+	if err != nil {
+		return false
+	}
+	defer assets.Close()
+	_, err = assets.ReadFile("scene.json")
+	return err == nil
+}
+
+// compileVideo converts a video wallpaper. The video is the input file, or the file of the project when the input
+// is a project directory or a pkg. projectPath is "" for a video without a project.json.
+func (job *compileJob) compileVideo(project Project, projectPath string) error {
+	projectDir := ""
+	if projectPath != "" {
+		projectDir = filepath.Dir(projectPath)
+	}
+
+	videoPath := job.options.Input
+	if info, err := os.Stat(videoPath); err != nil || !info.Mode().IsRegular() || inputType(videoPath) == "scene" {
+		if project.File == "" {
+			return NewError(InputError, errors.New("video project has no file"))
+		}
+		if !filepath.IsLocal(filepath.FromSlash(project.File)) {
+			return NewError(InputError, fmt.Errorf("video file %q is not inside the project directory", project.File))
+		}
+		videoPath = filepath.Join(projectDir, filepath.FromSlash(project.File))
+	}
+	videoFile := "video" + strings.ToLower(filepath.Ext(videoPath))
+	if err := job.archive.addFile(videoFile, videoPath); err != nil {
+		return NewError(InputError, fmt.Errorf("open video failed: %w", err))
+	}
+	job.addMetadata(project, projectDir, videoPath, videoFile, nil)
+	return job.writeOutput()
+}
@@ -0,0 +1,144 @@
+package compiler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindInputProject(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		project      string
+		matchesInput bool
+	}{
+		{"no project", "scene.pkg", "", false},
+		{"other pkg", "scene.pkg", `{"type": "scene", "file": "other.pkg"}`, false},
+		{"scene.json in the pkg", "scene.pkg", `{"type": "scene", "file": "scene.json"}`, true},
+		{"matching pkg", "scene.pkg", `{"type": "scene", "file": "scene.pkg"}`, true},
+		{"no file", "scene.pkg", `{"type": "scene"}`, true},
+		{"video project next to a pkg", "scene.pkg", `{"type": "video", "file": "video.mp4"}`, false},
+		{"matching video", "video.mp4", `{"type": "video", "file": "video.mp4"}`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, test.input)
+			if err := os.WriteFile(input, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			expectedPath := ""
+			if test.project != "" {
+				expectedPath = filepath.Join(dir, "project.json")
+				if err := os.WriteFile(expectedPath, []byte(test.project), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			job := &compileJob{options: Options{Input: input}}
+			projectPath, matchesInput, err := job.findInputProject()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if projectPath != expectedPath || matchesInput != test.matchesInput {
+				t.Errorf("findInputProject() = %q, %v, want %q, %v", projectPath, matchesInput, expectedPath,
+					test.matchesInput)
+			}
+			if !matchesInput && projectPath != "" && len(job.warnings) != 1 {
+				t.Errorf("warnings = %v, want one about the mismatch", job.warnings)
+			}
+		})
+	}
+}
+
+func TestInputType(t *testing.T) {
+	for input, expected := range map[string]string{
+		"scene.pkg":  "scene",
+		"SCENE.PKG":  "scene",
+		"video.mp4":  "video",
+		"video.webm": "video",
+		"clip.MKV":   "video",
+		"notes.txt":  "",
+		"scene":      "",
+	} {
+		if projectType := inputType(input); projectType != expected {
+			t.Errorf("inputType(%q) = %q, want %q", input, projectType, expected)
+		}
+	}
+}
+
+func TestFindInputProjectOfAnotherVideo(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "video.mp4")
+	for path, content := range map[string]string{
+		input:                              "",
+		filepath.Join(dir, "project.json"): `{"type": "video", "file": "other.mp4"}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	job := &compileJob{options: Options{Input: input}}
+	_, _, err := job.findInputProject()
+	var compileErr *Error
+	if !errors.As(err, &compileErr) || compileErr.Kind != InputError || !strings.Contains(err.Error(), "other.mp4") {
+		t.Errorf("error = %v, want an input error naming other.mp4", err)
+	}
+}
+
+func TestCompileVideo(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		project string
+		err     string
+	}{
+		{"video without project", "clip.webm", "", ""},
+		{"project directory", ".", `{"type": "video", "file": "clip.webm"}`, ""},
+		{"unknown file without project", "clip.bin", "", "open pkg failed"},
+		{"file outside the project", ".", `{"type": "video", "file": "../clip.webm"}`, "not inside the project directory"},
+		{"absolute file", ".", `{"type": "video", "file": "/clip.webm"}`, "not inside the project directory"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{filepath.Join(dir, "clip.webm"): "webm", filepath.Join(dir, "clip.bin"): "bin"}
+			if test.project != "" {
+				files[filepath.Join(dir, "project.json")] = test.project
+			}
+			for path, content := range files {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			options := Options{Input: filepath.Join(dir, test.input), AssetRoots: []string{dir}, Module: "scene.wasm"}
+			result, err := Compile(context.Background(), options)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			archive, err := zip.NewReader(bytes.NewReader(result.Output), int64(len(result.Output)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range archive.File {
+				if file.Name == "video.webm" {
+					return
+				}
+			}
+			t.Error("output has no video.webm")
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package compiler
+
+//go:generate go run gen_owapi.go
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	wasmSectionType   = 1
+	wasmSectionImport = 2
+	wasmSectionMemory = 5
+	wasmSectionExport = 7
+)
+
+const (
+	wasmKindFunction = 0
+	wasmKindTable    = 1
+	wasmKindMemory   = 2
+	wasmKindGlobal   = 3
+)
+
+type wasmFuncType struct {
+	Params  []byte
+	Results []byte
+}
+
+type wasmImport struct {
+	Module string
+	Name   string
+	Kind   byte
+	Type   int
+}
+
+type wasmExport struct {
+	Name  string
+	Kind  byte
+	Index int
+}
+
+type wasmLimits struct {
+	Min    uint64
+	Max    uint64
+	HasMax bool
+}
+
+type wasmModule struct {
+	Types    []wasmFuncType
+	Imports  []wasmImport
+	Exports  []wasmExport
+	Memories []wasmLimits
+}
+
+// wasmReader reads the parts of the WebAssembly binary format that are needed to check the scene module.
+type wasmReader struct {
+	data []byte
+	off  int
+}
+
+func (reader *wasmReader) readByte() (byte, error) {
+	if reader.off >= len(reader.data) {
+		return 0, errors.New("unexpected end of module")
+	}
+	value := reader.data[reader.off]
+	reader.off++
+	return value, nil
+}
+
+func (reader *wasmReader) readBytes(size uint64) ([]byte, error) {
+	if size > uint64(len(reader.data)-reader.off) {
+		return nil, errors.New("unexpected end of module")
+	}
+	value := reader.data[reader.off : reader.off+int(size)]
+	reader.off += int(size)
+	return value, nil
+}
+
+// readLEB reads an unsigned LEB128 number of at most 64 bits.
+func (reader *wasmReader) readLEB() (uint64, error) {
+	value := uint64(0)
+	for shift := 0; shift < 64; shift += 7 {
+		b, err := reader.readByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("LEB128 number is too long")
+}
+
+func (reader *wasmReader) readName() (string, error) {
+	size, err := reader.readLEB()
+	if err != nil {
+		return "", err
+	}
+	name, err := reader.readBytes(size)
+	return string(name), err
+}
+
+func (reader *wasmReader) readLimits() (wasmLimits, error) {
+	flags, err := reader.readByte()
+	if err != nil {
+		return wasmLimits{}, err
+	}
+	limits := wasmLimits{HasMax: flags&1 != 0}
+	if limits.Min, err = reader.readLEB(); err != nil {
+		return wasmLimits{}, err
+	}
+	if limits.HasMax {
+		if limits.Max, err = reader.readLEB(); err != nil {
+			return wasmLimits{}, err
+		}
+	}
+	return limits, nil
+}
+
+func (reader *wasmReader) readValueTypes() ([]byte, error) {
+	count, err := reader.readLEB()
+	if err != nil {
+		return nil, err
+	}
+	return reader.readBytes(count)
+}
+
+func parseWasmModule(data []byte) (wasmModule, error) {
+	if len(data) < 8 || !bytes.Equal(data[:4], []byte("\x00asm")) {
+		return wasmModule{}, errors.New("not a WebAssembly module")
+	}
+	if !bytes.Equal(data[4:8], []byte{1, 0, 0, 0}) {
+		return wasmModule{}, fmt.Errorf("unsupported WebAssembly version %v", data[4:8])
+	}
+
+	module := wasmModule{}
+	reader := &wasmReader{data: data, off: 8}
+	for reader.off < len(reader.data) {
+		sectionID, err := reader.readByte()
+		if err != nil {
+			return wasmModule{}, err
+		}
+		sectionSize, err := reader.readLEB()
+		if err != nil {
+			return wasmModule{}, err
+		}
+		sectionData, err := reader.readBytes(sectionSize)
+		if err != nil {
+			return wasmModule{}, fmt.Errorf("section %d: %w", sectionID, err)
+		}
+
+		section := &wasmReader{data: sectionData}
+		switch sectionID {
+		case wasmSectionType:
+			err = module.parseTypes(section)
+		case wasmSectionImport:
+			err = module.parseImports(section)
+		case wasmSectionMemory:
+			err = module.parseMemories(section)
+		case wasmSectionExport:
+			err = module.parseExports(section)
+		}
+		if err != nil {
+			return wasmModule{}, fmt.Errorf("section %d: %w", sectionID, err)
+		}
+	}
+	return module, nil
+}
+
+func appendLEB(data []byte, value uint64) []byte {
+	for value >= 0x80 {
+		data = append(data, byte(value&0x7f)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
+
+// setWasmMemoryLimits returns a copy of the module with the limits of its memory set to minPages and maxPages, the
+// other memory flags are kept.
+// Every other section is copied as is, so modules patched for different scenes share their code. The memory must
+// be defined by the module, an imported memory is sized by the host.
+func setWasmMemoryLimits(data []byte, minPages uint64, maxPages uint64) ([]byte, error) {
+	if _, err := parseWasmModule(data); err != nil {
+		return nil, err
+	}
+
+	result := slices.Clip(data[:8])
+	reader := &wasmReader{data: data, off: 8}
+	patched := false
+	for reader.off < len(reader.data) {
+		sectionStart := reader.off
+		sectionID, _ := reader.readByte()
+		sectionSize, _ := reader.readLEB()
+		sectionData, _ := reader.readBytes(sectionSize)
+		if sectionID != wasmSectionMemory {
+			result = append(result, data[sectionStart:reader.off]...)
+			continue
+		}
+
+		memories := &wasmModule{}
+		if err := memories.parseMemories(&wasmReader{data: sectionData}); err != nil {
+			return nil, err
+		}
+		if len(memories.Memories) != 1 {
+			return nil, fmt.Errorf("module defines %d memories, expected 1", len(memories.Memories))
+		}
+		// The flags byte follows the memory count, only the has-maximum bit is set, shared and memory64 are kept.
+		flags := sectionData[len(appendLEB(nil, 1))]
+		section := appendLEB(nil, 1)
+		section = append(section, flags|1)
+		section = appendLEB(section, minPages)
+		section = appendLEB(section, max(maxPages, minPages))
+		result = append(result, wasmSectionMemory)
+		result = appendLEB(result, uint64(len(section)))
+		result = append(result, section...)
+		patched = true
+	}
+	if !patched {
+		return nil, errors.New("module does not define its memory")
+	}
+	return result, nil
+}
+
+func (module *wasmModule) parseTypes(reader *wasmReader) error {
+	count, err := reader.readLEB()
+	if err != nil {
+		return err
+	}
+	for range count {
+		form, err := reader.readByte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return fmt.Errorf("unsupported type form 0x%x", form)
+		}
+		funcType := wasmFuncType{}
+		if funcType.Params, err = reader.readValueTypes(); err != nil {
+			return err
+		}
+		if funcType.Results, err = reader.readValueTypes(); err != nil {
+			return err
+		}
+		module.Types = append(module.Types, funcType)
+	}
+	return nil
+}
+
+func (module *wasmModule) parseImports(reader *wasmReader) error {
+	count, err := reader.readLEB()
+	if err != nil {
+		return err
+	}
+	for range count {
+		imp := wasmImport{Type: -1}
+		if imp.Module, err = reader.readName(); err != nil {
+			return err
+		}
+		if imp.Name, err = reader.readName(); err != nil {
+			return err
+		}
+		if imp.Kind, err = reader.readByte(); err != nil {
+			return err
+		}
+		switch imp.Kind {
+		case wasmKindFunction:
+			typeIndex, err := reader.readLEB()
+			if err != nil {
+				return err
+			}
+			imp.Type = int(typeIndex)
+		case wasmKindTable:
+			if _, err := reader.readByte(); err != nil {
+				return err
+			}
+			if _, err := reader.readLimits(); err != nil {
+				return err
+			}
+		case wasmKindMemory:
+			limits, err := reader.readLimits()
+			if err != nil {
+				return err
+			}
+			module.Memories = append(module.Memories, limits)
+		case wasmKindGlobal:
+			if _, err := reader.readBytes(2); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown import kind %d", imp.Kind)
+		}
+		module.Imports = append(module.Imports, imp)
+	}
+	return nil
+}
+
+func (module *wasmModule) parseMemories(reader *wasmReader) error {
+	count, err := reader.readLEB()
+	if err != nil {
+		return err
+	}
+	for range count {
+		limits, err := reader.readLimits()
+		if err != nil {
+			return err
+		}
+		module.Memories = append(module.Memories, limits)
+	}
+	return nil
+}
+
+func (module *wasmModule) parseExports(reader *wasmReader) error {
+	count, err := reader.readLEB()
+	if err != nil {
+		return err
+	}
+	for range count {
+		exp := wasmExport{}
+		if exp.Name, err = reader.readName(); err != nil {
+			return err
+		}
+		if exp.Kind, err = reader.readByte(); err != nil {
+			return err
+		}
+		index, err := reader.readLEB()
+		if err != nil {
+			return err
+		}
+		exp.Index = int(index)
+		module.Exports = append(module.Exports, exp)
+	}
+	return nil
+}
+
+const (
+	wasmTypeI32 = 0x7f
+	wasmTypeI64 = 0x7e
+	wasmTypeF32 = 0x7d
+	wasmTypeF64 = 0x7c
+)
+
+// wasiModule is the WASI version that wasi-libc imports from, wallpaperd provides it through WAMR.
+const wasiModule = "wasi_snapshot_preview1"
+
+// requiredExports are looked up by wallpaperd when it loads the module.
+var requiredExports = []struct {
+	name string
+	kind byte
+}{
+	{"init", wasmKindFunction},
+	{"update", wasmKindFunction},
+	{"malloc", wasmKindFunction},
+	{"free", wasmKindFunction},
+	{"__heap_base", wasmKindGlobal},
+}
+
+func formatWasmFuncType(funcType wasmFuncType) string {
+	names := map[byte]string{wasmTypeI32: "i32", wasmTypeI64: "i64", wasmTypeF32: "f32", wasmTypeF64: "f64"}
+	format := func(types []byte) string {
+		parts := []string{}
+		for _, valueType := range types {
+			parts = append(parts, cmp.Or(names[valueType], fmt.Sprintf("0x%x", valueType)))
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return format(funcType.Params) + " -> " + format(funcType.Results)
+}
+
+// validateModule checks that wallpaperd can instantiate the module: every import is an ow_* function from
+// openwallpaper.h with the same signature or comes from WASI, and the entry points are exported.
+func validateModule(moduleBytes []byte) error {
+	module, err := parseWasmModule(moduleBytes)
+	if err != nil {
+		return err
+	}
+
+	problems := []string{}
+	for _, imp := range module.Imports {
+		if imp.Module == wasiModule {
+			continue
+		}
+		if imp.Module != "env" || !strings.HasPrefix(imp.Name, "ow_") {
+			problems = append(problems, fmt.Sprintf("imports %s.%s, which wallpaperd does not provide", imp.Module, imp.Name))
+			continue
+		}
+		expected, ok := owFunctionTypes[imp.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("imports %s, which is not declared in openwallpaper.h", imp.Name))
+			continue
+		}
+		if imp.Kind != wasmKindFunction || imp.Type < 0 || imp.Type >= len(module.Types) {
+			problems = append(problems, fmt.Sprintf("imports %s as something other than a function", imp.Name))
+			continue
+		}
+		actual := module.Types[imp.Type]
+		if !bytes.Equal(actual.Params, expected.Params) || !bytes.Equal(actual.Results, expected.Results) {
+			problems = append(problems, fmt.Sprintf("imports %s as %s, but openwallpaper.h declares %s",
+				imp.Name, formatWasmFuncType(actual), formatWasmFuncType(expected)))
+		}
+	}
+
+	for _, required := range requiredExports {
+		index := slices.IndexFunc(module.Exports, func(exp wasmExport) bool { return exp.Name == required.name })
+		if index < 0 {
+			problems = append(problems, fmt.Sprintf("does not export %s", required.name))
+		} else if module.Exports[index].Kind != required.kind {
+			problems = append(problems, fmt.Sprintf("exports %s with the wrong kind", required.name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
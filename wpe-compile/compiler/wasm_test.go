@@ -0,0 +1,255 @@
+package compiler
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type testWasmImport struct {
+	module string
+	name   string
+	kind   byte
+	typ    int
+}
+
+// testWasm describes the sections of a module that parseWasmModule reads, bytes lays them out like a linker does.
+type testWasm struct {
+	types   []wasmFuncType
+	imports []testWasmImport
+	memory  *wasmLimits
+	exports []wasmExport
+}
+
+func testLEB(data []byte, value uint64) []byte {
+	for value >= 0x80 {
+		data = append(data, byte(value&0x7f)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
+
+func testWasmName(data []byte, name string) []byte {
+	return append(testLEB(data, uint64(len(name))), name...)
+}
+
+func testWasmLimits(data []byte, limits wasmLimits) []byte {
+	if !limits.HasMax {
+		return testLEB(append(data, 0), limits.Min)
+	}
+	return testLEB(testLEB(append(data, 1), limits.Min), limits.Max)
+}
+
+func (module testWasm) bytes() []byte {
+	data := []byte("\x00asm\x01\x00\x00\x00")
+	section := func(id byte, count int, content []byte) {
+		if count == 0 {
+			return
+		}
+		content = append(testLEB(nil, uint64(count)), content...)
+		data = append(testLEB(append(data, id), uint64(len(content))), content...)
+	}
+
+	types := []byte{}
+	for _, funcType := range module.types {
+		types = append(testLEB(append(types, 0x60), uint64(len(funcType.Params))), funcType.Params...)
+		types = append(testLEB(types, uint64(len(funcType.Results))), funcType.Results...)
+	}
+	section(wasmSectionType, len(module.types), types)
+
+	imports := []byte{}
+	for _, imp := range module.imports {
+		imports = append(testWasmName(testWasmName(imports, imp.module), imp.name), imp.kind)
+		switch imp.kind {
+		case wasmKindFunction:
+			imports = testLEB(imports, uint64(imp.typ))
+		case wasmKindGlobal:
+			imports = append(imports, wasmTypeI32, 0)
+		case wasmKindMemory:
+			imports = testWasmLimits(imports, wasmLimits{Min: 1})
+		}
+	}
+	section(wasmSectionImport, len(module.imports), imports)
+
+	if module.memory != nil {
+		section(wasmSectionMemory, 1, testWasmLimits(nil, *module.memory))
+	}
+
+	exports := []byte{}
+	for _, exp := range module.exports {
+		exports = testLEB(append(testWasmName(exports, exp.Name), exp.Kind), uint64(exp.Index))
+	}
+	section(wasmSectionExport, len(module.exports), exports)
+	return data
+}
+
+// validTestWasm is the smallest module that passes validateModule: it imports one ow_* function and one WASI
+// function and exports what wallpaperd looks up.
+func validTestWasm() testWasm {
+	return testWasm{
+		types: []wasmFuncType{
+			owFunctionTypes["ow_get_file_size"],
+			{Params: []byte{wasmTypeI32}, Results: []byte{}},
+		},
+		imports: []testWasmImport{
+			{"env", "ow_get_file_size", wasmKindFunction, 0},
+			{wasiModule, "proc_exit", wasmKindFunction, 1},
+		},
+		memory: &wasmLimits{Min: 2, Max: 4096, HasMax: true},
+		exports: []wasmExport{
+			{Name: "init", Kind: wasmKindFunction, Index: 2},
+			{Name: "update", Kind: wasmKindFunction, Index: 3},
+			{Name: "malloc", Kind: wasmKindFunction, Index: 4},
+			{Name: "free", Kind: wasmKindFunction, Index: 5},
+			{Name: "__heap_base", Kind: wasmKindGlobal, Index: 1},
+			{Name: "memory", Kind: wasmKindMemory, Index: 0},
+		},
+	}
+}
+
+func TestParseWasmModule(t *testing.T) {
+	valid := validTestWasm()
+	data := valid.bytes()
+	module, err := parseWasmModule(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(module.Types) != 2 || !bytes.Equal(module.Types[0].Params, valid.types[0].Params) ||
+		!bytes.Equal(module.Types[0].Results, valid.types[0].Results) {
+		t.Errorf("types = %v, want %v", module.Types, valid.types)
+	}
+	if len(module.Imports) != 2 || module.Imports[1] != (wasmImport{wasiModule, "proc_exit", wasmKindFunction, 1}) {
+		t.Errorf("imports = %v", module.Imports)
+	}
+	if len(module.Memories) != 1 || module.Memories[0] != *valid.memory {
+		t.Errorf("memories = %v, want [%v]", module.Memories, *valid.memory)
+	}
+	if !slices.Equal(module.Exports, valid.exports) {
+		t.Errorf("exports = %v, want %v", module.Exports, valid.exports)
+	}
+
+	unknownSection := append(slices.Clone(data), 0, 3, 1, 2, 3)
+	if _, err := parseWasmModule(unknownSection); err != nil {
+		t.Errorf("a section the parser does not need was not skipped: %v", err)
+	}
+
+	longLEB := append([]byte("\x00asm\x01\x00\x00\x00"), wasmSectionType)
+	longLEB = append(longLEB, bytes.Repeat([]byte{0x80}, 10)...)
+	badForm := testWasm{types: []wasmFuncType{{}}}.bytes()
+	badForm[len(badForm)-3] = 0x5f
+	badKind := testWasm{imports: []testWasmImport{{"env", "x", 9, 0}}}.bytes()
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a WebAssembly module"},
+		{"wrong magic", append([]byte("\x00wsm"), data[4:]...), "not a WebAssembly module"},
+		{"wrong version", append([]byte("\x00asm\x02\x00\x00\x00"), data[8:]...), "unsupported WebAssembly version"},
+		{"truncated section", data[:len(data)-1], "unexpected end of module"},
+		{"truncated section header", append(slices.Clone(data), wasmSectionMemory), "unexpected end of module"},
+		{"LEB128 too long", longLEB, "LEB128 number is too long"},
+		{"unsupported type form", badForm, "unsupported type form 0x5f"},
+		{"unknown import kind", badKind, "unknown import kind 9"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseWasmModule(test.data)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error = %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+
+	// Cutting the module anywhere inside a section must be reported, not read past the end.
+	boundaries := map[int]bool{8: true, len(data): true}
+	for reader := (&wasmReader{data: data, off: 8}); reader.off < len(data); boundaries[reader.off] = true {
+		_, _ = reader.readByte()
+		size, _ := reader.readLEB()
+		_, _ = reader.readBytes(size)
+	}
+	for size := range len(data) {
+		if _, err := parseWasmModule(data[:size]); (err == nil) != boundaries[size] {
+			t.Errorf("module cut at %d bytes: error = %v", size, err)
+		}
+	}
+}
+
+func TestValidateModule(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(module *testWasm)
+		err    string
+	}{
+		{"valid", func(module *testWasm) {}, ""},
+		{"wrong signature", func(module *testWasm) {
+			module.types[0] = wasmFuncType{Params: []byte{wasmTypeI64}, Results: []byte{wasmTypeI32}}
+		}, "imports ow_get_file_size as (i64) -> (i32), but openwallpaper.h declares (i32) -> (i32)"},
+		{"unknown function", func(module *testWasm) {
+			module.imports[0].name = "ow_get_file_sizes"
+		}, "imports ow_get_file_sizes, which is not declared in openwallpaper.h"},
+		{"other import module", func(module *testWasm) {
+			module.imports[1].module = "wasi_unstable"
+		}, "imports wasi_unstable.proc_exit, which wallpaperd does not provide"},
+		{"env function without ow_ prefix", func(module *testWasm) {
+			module.imports[0].name = "emscripten_memcpy_big"
+		}, "imports env.emscripten_memcpy_big, which wallpaperd does not provide"},
+		{"ow_ import that is not a function", func(module *testWasm) {
+			module.imports[0].kind = wasmKindGlobal
+		}, "imports ow_get_file_size as something other than a function"},
+		{"type index out of range", func(module *testWasm) {
+			module.imports[0].typ = 7
+		}, "imports ow_get_file_size as something other than a function"},
+		{"missing export", func(module *testWasm) {
+			module.exports = slices.DeleteFunc(module.exports, func(exp wasmExport) bool { return exp.Name == "update" })
+		}, "does not export update"},
+		{"export of the wrong kind", func(module *testWasm) {
+			module.exports[4].Kind = wasmKindFunction
+		}, "exports __heap_base with the wrong kind"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := validTestWasm()
+			test.modify(&module)
+			err := validateModule(module.bytes())
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error = %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+
+	if err := validateModule([]byte("not wasm")); err == nil {
+		t.Error("validating something that is not wasm succeeded")
+	}
+}
+
+func TestOwFunctionTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"ow_get_file_size", "(i32) -> (i32)"},
+		{"ow_read_file", "(i32, i32) -> ()"},
+		{"ow_get_mouse_state", "(i32, i32) -> (i32)"},
+		{"ow_create_index_buffer", "(i32, i32) -> (i32)"},
+		{"ow_begin_copy_pass", "() -> ()"},
+		{"ow_render_geometry_indexed", "(i32, i32, i32, i32, i32, i32) -> ()"},
+	}
+	for _, test := range tests {
+		funcType, ok := owFunctionTypes[test.name]
+		if !ok {
+			t.Errorf("%s is missing", test.name)
+			continue
+		}
+		if actual := formatWasmFuncType(funcType); actual != test.expected {
+			t.Errorf("%s = %s, want %s", test.name, actual, test.expected)
+		}
+	}
+}
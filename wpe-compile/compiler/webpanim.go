@@ -0,0 +1,149 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+const (
+	webpFlagAnimation = 0x02
+	webpFlagAlpha     = 0x10
+	webpMaxDuration   = 1<<24 - 1
+)
+
+// webpAnimationEncoder builds an animated WebP container. Every frame is encoded as a still WebP as soon as it is
+// added and only its bitstream is kept, so frames do not pile up in memory.
+type webpAnimationEncoder struct {
+	options  *webp.Options
+	width    int
+	height   int
+	frames   int
+	hasAlpha bool
+	body     bytes.Buffer
+}
+
+func newWEBPAnimationEncoder(options *webp.Options) *webpAnimationEncoder {
+	return &webpAnimationEncoder{options: options}
+}
+
+// addFrame encodes a full canvas image shown for duration milliseconds, it is drawn without blending.
+func (encoder *webpAnimationEncoder) addFrame(frame image.Image, duration int) error {
+	bounds := frame.Bounds()
+	if encoder.frames == 0 {
+		encoder.width, encoder.height = bounds.Dx(), bounds.Dy()
+	} else if bounds.Dx() != encoder.width || bounds.Dy() != encoder.height {
+		return fmt.Errorf("frame %d has size %dx%d, expected %dx%d",
+			encoder.frames, bounds.Dx(), bounds.Dy(), encoder.width, encoder.height)
+	}
+
+	encoded := new(bytes.Buffer)
+	if err := webp.Encode(encoded, frame, encoder.options); err != nil {
+		return fmt.Errorf("encode frame %d failed: %w", encoder.frames, err)
+	}
+	bitstream, alpha, err := webpFrameBitstream(encoded.Bytes())
+	if err != nil {
+		return fmt.Errorf("read frame %d failed: %w", encoder.frames, err)
+	}
+	encoder.hasAlpha = encoder.hasAlpha || alpha
+
+	duration = min(max(duration, 0), webpMaxDuration)
+	header := make([]byte, 16)
+	putUint24(header[6:], uint32(encoder.width-1))
+	putUint24(header[9:], uint32(encoder.height-1))
+	putUint24(header[12:], uint32(duration))
+	header[15] = 0x02
+	writeWEBPChunk(&encoder.body, "ANMF", append(header, bitstream...))
+	encoder.frames++
+	return nil
+}
+
+// finish returns the animated WebP file, loopCount 0 means infinite looping.
+func (encoder *webpAnimationEncoder) finish(loopCount int) ([]byte, error) {
+	if encoder.frames == 0 {
+		return nil, errors.New("animation has no frames")
+	}
+
+	flags := byte(webpFlagAnimation)
+	if encoder.hasAlpha {
+		flags |= webpFlagAlpha
+	}
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	putUint24(vp8x[4:], uint32(encoder.width-1))
+	putUint24(vp8x[7:], uint32(encoder.height-1))
+
+	anim := make([]byte, 6)
+	binary.LittleEndian.PutUint16(anim[4:], uint16(loopCount))
+
+	chunks := new(bytes.Buffer)
+	writeWEBPChunk(chunks, "VP8X", vp8x)
+	writeWEBPChunk(chunks, "ANIM", anim)
+	chunks.Write(encoder.body.Bytes())
+
+	result := new(bytes.Buffer)
+	result.WriteString("RIFF")
+	_ = binary.Write(result, binary.LittleEndian, uint32(4+chunks.Len()))
+	result.WriteString("WEBP")
+	result.Write(chunks.Bytes())
+	return result.Bytes(), nil
+}
+
+// webpFrameBitstream returns ALPH, VP8 and VP8L chunks of a still WebP file, ready to be put into an ANMF chunk,
+// and whether the frame uses alpha.
+func webpFrameBitstream(data []byte) ([]byte, bool, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false, errors.New("not a WebP file")
+	}
+
+	bitstream := new(bytes.Buffer)
+	hasAlpha := false
+	for offset := 12; offset+8 <= len(data); {
+		fourCC := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		end := offset + 8 + size + size%2
+		if offset+8+size > len(data) {
+			return nil, false, fmt.Errorf("chunk %s is truncated", fourCC)
+		}
+		switch fourCC {
+		case "ALPH":
+			hasAlpha = true
+			bitstream.Write(data[offset:min(end, len(data))])
+		case "VP8L":
+			// The header after the 0x2f signature holds 14 bits of width and height each, then the alpha_is_used bit.
+			if size >= 5 && binary.LittleEndian.Uint32(data[offset+9:offset+13])>>28&1 != 0 {
+				hasAlpha = true
+			}
+			bitstream.Write(data[offset:min(end, len(data))])
+		case "VP8 ":
+			bitstream.Write(data[offset:min(end, len(data))])
+		}
+		offset = end
+	}
+	if bitstream.Len() == 0 {
+		return nil, false, errors.New("WebP file has no image data")
+	}
+	if bitstream.Len()%2 != 0 {
+		bitstream.WriteByte(0)
+	}
+	return bitstream.Bytes(), hasAlpha, nil
+}
+
+func writeWEBPChunk(w *bytes.Buffer, fourCC string, payload []byte) {
+	w.WriteString(fourCC)
+	_ = binary.Write(w, binary.LittleEndian, uint32(len(payload)))
+	w.Write(payload)
+	if len(payload)%2 != 0 {
+		w.WriteByte(0)
+	}
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
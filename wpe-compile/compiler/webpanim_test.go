@@ -0,0 +1,149 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"slices"
+	"testing"
+
+	"github.com/chai2010/webp"
+)
+
+// webpChunks returns the fourCCs of the top level chunks of a WebP file and the payload of the first one of each.
+func webpChunks(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		t.Fatalf("not a WebP file")
+	}
+	if size := binary.LittleEndian.Uint32(data[4:8]); int(size) != len(data)-8 {
+		t.Fatalf("RIFF size %d, file has %d bytes after it", size, len(data)-8)
+	}
+	names := []string{}
+	payloads := map[string][]byte{}
+	for offset := 12; offset < len(data); {
+		name := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		names = append(names, name)
+		if _, exists := payloads[name]; !exists {
+			payloads[name] = data[offset+8 : offset+8+size]
+		}
+		offset += 8 + size + size%2
+	}
+	return names, payloads
+}
+
+func TestMakeAnimatedPreviewWEBP(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	animation := &gif.GIF{Config: image.Config{Width: 64, Height: 36}, LoopCount: 2}
+	for index := range 3 {
+		frame := image.NewPaletted(image.Rect(index*8, 0, index*8+16, 16), palette)
+		for pixel := range frame.Pix {
+			frame.Pix[pixel] = uint8(1 + index%2)
+		}
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 5*(index+1))
+		animation.Disposal = append(animation.Disposal, []byte{gif.DisposalNone, gif.DisposalBackground,
+			gif.DisposalPrevious}[index])
+	}
+
+	previewWEBP, err := makeAnimatedPreviewWEBP(animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, payloads := webpChunks(t, previewWEBP)
+	expected := []string{"VP8X", "ANIM", "ANMF", "ANMF", "ANMF"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("chunks = %v, want %v", names, expected)
+	}
+	vp8x := payloads["VP8X"]
+	if vp8x[0]&webpFlagAnimation == 0 {
+		t.Error("VP8X has no animation flag")
+	}
+	width := int(vp8x[4]) | int(vp8x[5])<<8 | int(vp8x[6])<<16 + 1
+	height := int(vp8x[7]) | int(vp8x[8])<<8 | int(vp8x[9])<<16 + 1
+	if width != 64 || height != 36 {
+		t.Errorf("canvas = %dx%d, want 64x36", width, height)
+	}
+	if loops := binary.LittleEndian.Uint16(payloads["ANIM"][4:]); loops != 3 {
+		t.Errorf("loop count = %d, want 3", loops)
+	}
+	firstFrame := payloads["ANMF"]
+	if duration := int(firstFrame[12]) | int(firstFrame[13])<<8 | int(firstFrame[14])<<16; duration != 50 {
+		t.Errorf("first frame duration = %d, want 50", duration)
+	}
+}
+
+func TestWEBPAnimationEncoderRejectsMismatchedFrames(t *testing.T) {
+	encoder := newWEBPAnimationEncoder(nil)
+	if _, err := encoder.finish(0); err == nil {
+		t.Error("finishing an empty animation succeeded")
+	}
+	if err := encoder.addFrame(image.NewRGBA(image.Rect(0, 0, 8, 8)), 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.addFrame(image.NewRGBA(image.Rect(0, 0, 8, 4)), 100); err == nil {
+		t.Error("adding a frame of another size succeeded")
+	}
+}
+
+func TestWEBPFrameBitstreamAlpha(t *testing.T) {
+	still := func(chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		for _, chunk := range chunks {
+			body = append(body, chunk...)
+		}
+		return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+	}
+	chunk := func(fourCC string, payload ...byte) []byte {
+		data := append(binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(payload))), payload...)
+		if len(payload)%2 != 0 {
+			data = append(data, 0)
+		}
+		return data
+	}
+	vp8l := func(alpha bool) []byte {
+		header := uint32(15) | uint32(15)<<14
+		if alpha {
+			header |= 1 << 28
+		}
+		return chunk("VP8L", binary.LittleEndian.AppendUint32([]byte{0x2f}, header)...)
+	}
+
+	encoded := func(fill color.Color) []byte {
+		img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+		draw.Draw(img, img.Bounds(), image.NewUniform(fill), image.Point{}, draw.Src)
+		data := &bytes.Buffer{}
+		if err := webp.Encode(data, img, &webp.Options{Lossless: true}); err != nil {
+			t.Fatal(err)
+		}
+		return data.Bytes()
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		alpha bool
+	}{
+		{"encoded opaque", encoded(color.NRGBA{255, 0, 0, 255}), false},
+		{"encoded transparent", encoded(color.NRGBA{255, 0, 0, 128}), true},
+		{"opaque VP8L", still(vp8l(false)), false},
+		{"VP8L with alpha", still(vp8l(true)), true},
+		{"VP8", still(chunk("VP8 ", 0, 0)), false},
+		{"VP8 with ALPH", still(chunk("ALPH", 0), chunk("VP8 ", 0, 0)), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, alpha, err := webpFrameBitstream(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alpha != test.alpha {
+				t.Errorf("alpha = %v, want %v", alpha, test.alpha)
+			}
+		})
+	}
+}
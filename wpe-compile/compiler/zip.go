@@ -0,0 +1,276 @@
+package compiler
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// zipTimestamp is the earliest time zip can store, used when no timestamp is given.
+var zipTimestamp = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// zipMaxTimestamp is the latest time zip can store, the year only has 7 bits.
+var zipMaxTimestamp = time.Date(2107, time.December, 31, 23, 59, 58, 0, time.UTC)
+
+// storedExtensions are formats that are already compressed, deflating them again only costs time.
+var storedExtensions = map[string]bool{
+	".webp": true,
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".mp4":  true,
+	".webm": true,
+	".mkv":  true,
+	".mov":  true,
+	".avi":  true,
+	".ogv":  true,
+}
+
+// archive collects output entries in a spool file as tasks finish, compressed or stored depending on their
+// format. The zip is only written at the end, with entries sorted by name, so the output does not depend on
+// the order tasks finished in. Entries are written twice, to the spool and then to the zip, because writing the
+// zip directly would either take them in the order tasks finish or keep all of them in memory until the end.
+// Copying from the spool takes a fixed size buffer, so memory does not grow with the size of entries.
+type archive struct {
+	spool   *os.File
+	size    int64
+	free    []spoolRegion
+	entries map[string]archiveEntry
+	mutex   sync.Mutex
+}
+
+// spoolRegion is space in the spool left by a replaced entry, later entries are written there if they fit.
+type spoolRegion struct {
+	offset int64
+	size   int64
+}
+
+type archiveEntry struct {
+	method           uint16
+	crc32            uint32
+	offset           int64
+	compressedSize   int64
+	uncompressedSize int64
+}
+
+// newArchive creates the spool in dir, which should be where the zip is written to, so that the spool is on the
+// same disk instead of in a temp dir that may be in memory. The system temp dir is used if dir is empty.
+func newArchive(dir string) (*archive, error) {
+	spool, err := os.CreateTemp(dir, ".wpe-compile-*.spool")
+	if err != nil {
+		return nil, err
+	}
+	return &archive{spool: spool, entries: map[string]archiveEntry{}}, nil
+}
+
+func (archive *archive) close() {
+	_ = archive.spool.Close()
+	_ = os.Remove(archive.spool.Name())
+}
+
+func entryMethod(name string) uint16 {
+	if storedExtensions[strings.ToLower(path.Ext(name))] {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// add compresses data in the calling goroutine and writes it to the spool. Adding a name again replaces the
+// entry, unless the data is the same.
+func (archive *archive) add(name string, data []byte) error {
+	entry := archiveEntry{
+		method:           entryMethod(name),
+		crc32:            crc32.ChecksumIEEE(data),
+		uncompressedSize: int64(len(data)),
+	}
+	if entry.method == zip.Deflate {
+		buffer := bytes.Buffer{}
+		flateWriter, err := flate.NewWriter(&buffer, flate.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := flateWriter.Write(data); err != nil {
+			return err
+		}
+		if err := flateWriter.Close(); err != nil {
+			return err
+		}
+		data = buffer.Bytes()
+	}
+	entry.compressedSize = int64(len(data))
+
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	if archive.holds(name, entry, data) {
+		return nil
+	}
+	entry.offset = archive.allocate(entry.compressedSize)
+	if _, err := archive.spool.WriteAt(data, entry.offset); err != nil {
+		return fmt.Errorf("write %s to spool failed: %w", name, err)
+	}
+	archive.put(name, entry)
+	return nil
+}
+
+// holds tells if name is already in the spool with the same compressed data.
+func (archive *archive) holds(name string, entry archiveEntry, data []byte) bool {
+	old, ok := archive.entries[name]
+	if !ok || old.method != entry.method || old.crc32 != entry.crc32 || old.compressedSize != entry.compressedSize {
+		return false
+	}
+	oldData := make([]byte, old.compressedSize)
+	if _, err := archive.spool.ReadAt(oldData, old.offset); err != nil {
+		return false
+	}
+	return bytes.Equal(oldData, data)
+}
+
+// allocate returns where size bytes can be written in the spool, space of replaced entries is used first.
+func (archive *archive) allocate(size int64) int64 {
+	for index, region := range archive.free {
+		if region.size < size {
+			continue
+		}
+		if region.size == size {
+			archive.free = slices.Delete(archive.free, index, index+1)
+		} else {
+			archive.free[index] = spoolRegion{offset: region.offset + size, size: region.size - size}
+		}
+		return region.offset
+	}
+	offset := archive.size
+	archive.size += size
+	return offset
+}
+
+// put records entry under name and frees the space of the entry it replaces.
+func (archive *archive) put(name string, entry archiveEntry) {
+	if old, ok := archive.entries[name]; ok && old.compressedSize > 0 {
+		archive.free = append(archive.free, spoolRegion{offset: old.offset, size: old.compressedSize})
+	}
+	archive.entries[name] = entry
+}
+
+// addFile copies a file into the spool as is, without reading it into memory. It is meant for large inputs
+// that are already compressed, like videos.
+func (archive *archive) addFile(name string, sourcePath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	hash := crc32.NewIEEE()
+	written, err := io.Copy(io.MultiWriter(io.NewOffsetWriter(archive.spool, archive.size), hash), source)
+	entry := archiveEntry{
+		method:           zip.Store,
+		crc32:            hash.Sum32(),
+		offset:           archive.size,
+		compressedSize:   written,
+		uncompressedSize: written,
+	}
+	archive.size += written
+	if err != nil {
+		return fmt.Errorf("write %s to spool failed: %w", name, err)
+	}
+	archive.put(name, entry)
+	return nil
+}
+
+func (archive *archive) read(name string) ([]byte, error) {
+	archive.mutex.Lock()
+	entry, ok := archive.entries[name]
+	archive.mutex.Unlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	var reader io.Reader = io.NewSectionReader(archive.spool, entry.offset, entry.compressedSize)
+	if entry.method == zip.Deflate {
+		flateReader := flate.NewReader(reader)
+		defer flateReader.Close()
+		reader = flateReader
+	}
+	return io.ReadAll(reader)
+}
+
+// writeZip writes all entries sorted by name with the same modification time, so the same entries always
+// give the same archive.
+func (archive *archive) writeZip(writer io.Writer, timestamp time.Time) error {
+	if timestamp.IsZero() || timestamp.Before(zipTimestamp) {
+		timestamp = zipTimestamp
+	}
+	if timestamp.After(zipMaxTimestamp) {
+		timestamp = zipMaxTimestamp
+	}
+	timestamp = timestamp.UTC()
+	modifiedDate, modifiedTime := msDosTime(timestamp)
+
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	zipWriter := zip.NewWriter(writer)
+	for _, name := range slices.Sorted(maps.Keys(archive.entries)) {
+		entry := archive.entries[name]
+		header := &zip.FileHeader{
+			Name:               name,
+			Method:             entry.method,
+			ModifiedDate:       modifiedDate,
+			ModifiedTime:       modifiedTime,
+			CRC32:              entry.crc32,
+			CompressedSize64:   uint64(entry.compressedSize),
+			UncompressedSize64: uint64(entry.uncompressedSize),
+		}
+		header.SetMode(0644)
+
+		entryWriter, err := zipWriter.CreateRaw(header)
+		if err != nil {
+			_ = zipWriter.Close()
+			return err
+		}
+		if _, err := io.Copy(entryWriter, io.NewSectionReader(archive.spool, entry.offset, entry.compressedSize)); err != nil {
+			_ = zipWriter.Close()
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+// writeZipFile writes the zip next to outputPath and renames it into place, so an interrupted build never
+// leaves a truncated archive behind.
+func (archive *archive) writeZipFile(outputPath string, timestamp time.Time) error {
+	file, err := os.CreateTemp(filepath.Dir(outputPath), ".wpe-compile-*.owf")
+	if err != nil {
+		return err
+	}
+	err = errors.Join(file.Chmod(0644), archive.writeZip(file, timestamp), file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), outputPath)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// msDosTime converts t to the date and time fields of zip headers, with two second precision.
+func msDosTime(t time.Time) (uint16, uint16) {
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
@@ -0,0 +1,208 @@
+package compiler
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveReplace(t *testing.T) {
+	archive, err := newArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.close()
+
+	large := []byte(strings.Repeat("large puppet ", 64))
+	if err := archive.add("models/puppet.mdl", large); err != nil {
+		t.Fatal(err)
+	}
+	size := archive.size
+	if err := archive.add("models/puppet.mdl", large); err != nil {
+		t.Fatal(err)
+	}
+	if archive.size != size {
+		t.Errorf("adding the same data again grew the spool from %d to %d bytes", size, archive.size)
+	}
+
+	if err := archive.add("models/puppet.mdl", []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	size = archive.size
+	if err := archive.add("scene.bin", []byte("WPES")); err != nil {
+		t.Fatal(err)
+	}
+	if archive.size != size {
+		t.Errorf("space of the replaced entry was not reused, spool grew from %d to %d bytes", size, archive.size)
+	}
+
+	for name, expected := range map[string]string{"models/puppet.mdl": "small", "scene.bin": "WPES"} {
+		data, err := archive.read(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s = %q, want %q", name, data, expected)
+		}
+	}
+}
+
+func TestArchiveWriteZip(t *testing.T) {
+	files := map[string]string{
+		"scene.bin":           "WPES",
+		"textures/0.webp":     "RIFF webp",
+		"shaders/0_frag.spv":  strings.Repeat("spirv", 32),
+		"metadata.toml":       "[wallpaper]",
+		"shaders/0_vert.spv":  "",
+		"textures/10.webp":    "RIFF other",
+		"models/puppet.mdl":   "MDLV",
+		"shaders/0_vert.glsl": "void main() {}",
+	}
+	outputs := [][]byte{}
+	for _, reverse := range []bool{false, true} {
+		archive, err := newArchive(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := slices.Sorted(maps.Keys(files))
+		if reverse {
+			slices.Reverse(names)
+		}
+		for _, name := range names {
+			if err := archive.add(name, []byte(files[name])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		output := bytes.Buffer{}
+		if err := archive.writeZip(&output, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		archive.close()
+		outputs = append(outputs, output.Bytes())
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("the same entries added in another order give another archive")
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(outputs[0]), int64(len(outputs[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := ""
+	for _, file := range reader.File {
+		if file.Name <= previous {
+			t.Errorf("%s comes after %s", file.Name, previous)
+		}
+		previous = file.Name
+		if expected := entryMethod(file.Name); file.Method != expected {
+			t.Errorf("%s method = %d, want %d", file.Name, file.Method, expected)
+		}
+		content, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			t.Fatalf("read %s: %v", file.Name, err)
+		}
+		if string(data) != files[file.Name] {
+			t.Errorf("%s = %q, want %q", file.Name, data, files[file.Name])
+		}
+	}
+	if len(reader.File) != len(files) {
+		t.Errorf("got %d entries, want %d", len(reader.File), len(files))
+	}
+}
+
+func TestArchiveTimestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		expected  time.Time
+	}{
+		{"zero", time.Time{}, zipTimestamp},
+		{"before 1980", time.Unix(0, 0), zipTimestamp},
+		{"odd second", time.Date(2024, time.May, 17, 13, 45, 31, 0, time.UTC),
+			time.Date(2024, time.May, 17, 13, 45, 30, 0, time.UTC)},
+		{"other zone", time.Date(2024, time.May, 17, 23, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60)),
+			time.Date(2024, time.May, 17, 20, 0, 0, 0, time.UTC)},
+		{"last year", time.Date(2107, time.June, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2107, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"after 2107", time.Date(2108, time.January, 1, 0, 0, 0, 0, time.UTC), zipMaxTimestamp},
+		{"far future", time.Unix(1<<40, 0), zipMaxTimestamp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archive, err := newArchive(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.close()
+			if err := archive.add("scene.bin", []byte("WPES")); err != nil {
+				t.Fatal(err)
+			}
+			output := bytes.Buffer{}
+			if err := archive.writeZip(&output, test.timestamp); err != nil {
+				t.Fatal(err)
+			}
+			reader, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := reader.File[0].FileHeader
+			if modified := msDosTimeToTime(header.ModifiedDate, header.ModifiedTime); !modified.Equal(test.expected) {
+				t.Errorf("modified = %v, want %v", modified, test.expected)
+			}
+		})
+	}
+}
+
+func msDosTimeToTime(date uint16, clock uint16) time.Time {
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0xf), int(date&0x1f), int(clock>>11), int(clock>>5&0x3f),
+		int(clock&0x1f)*2, 0, time.UTC)
+}
+
+func TestArchiveFileMemory(t *testing.T) {
+	allocated := func(size int64) uint64 {
+		dir := t.TempDir()
+		videoPath := filepath.Join(dir, "video.mp4")
+		video, err := os.Create(videoPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := errors.Join(video.Truncate(size), video.Close()); err != nil {
+			t.Fatal(err)
+		}
+		archive, err := newArchive(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer archive.close()
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if err := archive.addFile("video.mp4", videoPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := archive.writeZip(io.Discard, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	small := allocated(1 << 20)
+	large := allocated(64 << 20)
+	if large > small+1<<20 {
+		t.Errorf("adding and writing a 64 MiB file allocated %d bytes, a 1 MiB one %d", large, small)
+	}
+}
@@ -1,8 +1,9 @@
-module wpe-compile
+module github.com/mechakotik/openwallpaper/wpe-compile
 
 go 1.25.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/alexflint/go-arg v1.6.0
 	github.com/chai2010/webp v1.4.0
 	github.com/pierrec/lz4/v4 v4.1.22
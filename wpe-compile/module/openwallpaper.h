@@ -1 +0,0 @@
-../../include/openwallpaper.h
\ No newline at end of file
@@ -1,2 +0,0 @@
-#define WPE_COMPILE_SCENE_DEFINE
-#include "defs.h"
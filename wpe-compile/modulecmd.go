@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexflint/go-arg"
+
+	"github.com/mechakotik/openwallpaper/wpe-compile/compiler"
+)
+
+type moduleArgs struct {
+	Output      string        `arg:"positional,required"`
+	TaskTimeout time.Duration `arg:"--task-timeout"`
+	CacheDir    string        `arg:"--cache-dir"`
+	NoCache     bool          `arg:"--no-cache"`
+	Debug       bool          `arg:"--debug"`
+}
+
+// runModuleCommand builds the scene module that is shared by all converted scenes, so that it can be passed
+// with --module on machines without a WASM C compiler.
+func runModuleCommand(module *moduleArgs, commandArgs []string) error {
+	parser, err := arg.NewParser(arg.Config{Program: "wpe-compile module"}, module)
+	if err != nil {
+		return err
+	}
+	err = parser.Parse(commandArgs)
+	if errors.Is(err, arg.ErrHelp) {
+		parser.WriteHelp(os.Stdout)
+		return nil
+	}
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	moduleBytes, err := compiler.BuildModule(ctx, compiler.Options{
+		WasmCC:      os.Getenv("WPE_COMPILE_WASM_CC"),
+		CacheDir:    cacheDir(module.CacheDir, module.NoCache),
+		TaskTimeout: module.TaskTimeout,
+	})
+	if errors.Is(err, compiler.ErrNoWasmCC) {
+		return compiler.NewError(compiler.ToolchainError, errors.New("WPE_COMPILE_WASM_CC is not set"))
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(module.Output, moduleBytes, 0644); err != nil {
+		return compiler.NewError(compiler.OutputError, fmt.Errorf("write module failed: %w", err))
+	}
+	return nil
+}
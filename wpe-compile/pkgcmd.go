@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alexflint/go-arg"
+
+	"github.com/mechakotik/openwallpaper/wpe-compile/compiler"
+)
+
+type pkgExtractArgs struct {
+	Input  string `arg:"positional,required"`
+	Output string `arg:"positional"`
+	List   bool   `arg:"--list"`
+}
+
+type pkgPackArgs struct {
+	Input   string `arg:"positional,required"`
+	Output  string `arg:"positional,required"`
+	Version int    `arg:"--version" default:"1"`
+}
+
+type pkgCommandArgs struct {
+	Extract *pkgExtractArgs `arg:"subcommand:extract"`
+	Pack    *pkgPackArgs    `arg:"subcommand:pack"`
+}
+
+func runPkgCommand(commandArgs []string) error {
+	var pkgArgs pkgCommandArgs
+	parser, err := arg.NewParser(arg.Config{Program: "wpe-compile pkg"}, &pkgArgs)
+	if err != nil {
+		return err
+	}
+	err = parser.Parse(commandArgs)
+	if errors.Is(err, arg.ErrHelp) {
+		parser.WriteHelpForSubcommand(os.Stdout, parser.SubcommandNames()...)
+		return nil
+	}
+	if err != nil {
+		parser.FailSubcommand(err.Error(), parser.SubcommandNames()...)
+	}
+
+	switch {
+	case pkgArgs.Extract != nil:
+		return extractPkgCommand(pkgArgs.Extract)
+	case pkgArgs.Pack != nil:
+		return packPkgCommand(pkgArgs.Pack)
+	default:
+		parser.WriteHelp(os.Stdout)
+		return nil
+	}
+}
+
+func extractPkgCommand(extractArgs *pkgExtractArgs) error {
+	if !extractArgs.List && extractArgs.Output == "" {
+		return compiler.NewError(compiler.InputError, errors.New("output directory is required unless --list is given"))
+	}
+
+	pkg, err := compiler.OpenPkg(extractArgs.Input, filepath.Base(extractArgs.Input))
+	if err != nil {
+		return compiler.NewError(compiler.InputError, err)
+	}
+	defer pkg.Close()
+	if warning := pkg.Warning(); warning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+
+	if extractArgs.List {
+		fmt.Printf("%s, %d entries\n", compiler.PkgMagic(pkg.Version()), len(pkg.Entries()))
+	}
+	for _, entry := range pkg.Entries() {
+		if extractArgs.List {
+			fmt.Printf("%10d %10d %s\n", entry.Offset, entry.Length, entry.Path)
+		}
+		if extractArgs.Output != "" {
+			if err := pkg.ExtractEntry(entry, extractArgs.Output); err != nil {
+				return compiler.NewError(compiler.OutputError, fmt.Errorf("extract %s: %w", entry.Path, err))
+			}
+		}
+	}
+	return nil
+}
+
+func packPkgCommand(packArgs *pkgPackArgs) error {
+	info, err := os.Stat(packArgs.Input)
+	if err != nil {
+		return compiler.NewError(compiler.InputError, err)
+	}
+	if !info.IsDir() {
+		return compiler.NewError(compiler.InputError, fmt.Errorf("%s is not a directory", packArgs.Input))
+	}
+	if rel, err := filepath.Rel(packArgs.Input, packArgs.Output); err == nil && filepath.IsLocal(rel) {
+		return compiler.NewError(compiler.InputError, errors.New("output file must not be inside the input directory"))
+	}
+
+	file, err := os.Create(packArgs.Output)
+	if err != nil {
+		return compiler.NewError(compiler.OutputError, err)
+	}
+	if err := compiler.WritePkg(file, packArgs.Input, packArgs.Version); err != nil {
+		_ = file.Close()
+		_ = os.Remove(packArgs.Output)
+		return compiler.NewError(compiler.OutputError, err)
+	}
+	if err := file.Close(); err != nil {
+		return compiler.NewError(compiler.OutputError, err)
+	}
+	return nil
+}